@@ -1,13 +1,22 @@
 package config
 
 import (
+	"log"
 	"os"
+	"strconv"
 )
 
 type Config struct {
 	DatabaseURL string
 	AIModelURL  string
 	Port        string
+	// AnalysisWorkers is how many background jobs the instance processes at once
+	AnalysisWorkers int
+	// AIMaxConcurrency caps the requests in flight to the AI model across all instances
+	// sharing the database
+	AIMaxConcurrency int
+	// ShutdownTimeoutSeconds is how long a shutdown waits for requests and analyses to finish
+	ShutdownTimeoutSeconds int
 }
 
 func New() *Config {
@@ -15,6 +24,11 @@ func New() *Config {
 		DatabaseURL: os.Getenv("DATABASE_URL"),
 		AIModelURL:  os.Getenv("AI_MODEL_URL"),
 		Port:        getEnvOrDefault("PORT", "8000"),
+
+		AnalysisWorkers:  getEnvIntOrDefault("ANALYSIS_WORKERS", 4),
+		AIMaxConcurrency: getEnvIntOrDefault("AI_MAX_CONCURRENCY", 4),
+
+		ShutdownTimeoutSeconds: getEnvIntOrDefault("SHUTDOWN_TIMEOUT_SECONDS", 30),
 	}
 }
 
@@ -25,6 +39,20 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvIntOrDefault reads a positive integer, falling back to the default when it is unset or invalid
+func getEnvIntOrDefault(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 1 {
+		log.Printf("Invalid %s=%q, using %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
 // GetDatabaseURL constructs database URL from individual components if DATABASE_URL is not set
 func (c *Config) GetDatabaseURL() string {
 	if c.DatabaseURL != "" {
@@ -13,7 +13,7 @@ CREATE TABLE IF NOT EXISTS projects (
     files_count INTEGER DEFAULT 0,
     received_files_count INTEGER DEFAULT 0,
     has_test_results BOOLEAN DEFAULT FALSE,
-    status VARCHAR(50) DEFAULT 'initialized',
+    status VARCHAR(50) DEFAULT 'collecting', -- collecting, ready, analyzing, completed, failed, cancelled
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -53,13 +53,177 @@ CREATE TABLE IF NOT EXISTS analysis_results (
     completed_at TIMESTAMP
 );
 
+-- Create input_reviews table
+CREATE TABLE IF NOT EXISTS input_reviews (
+    id SERIAL PRIMARY KEY,
+    project_uuid UUID UNIQUE NOT NULL REFERENCES projects(uuid),
+    issues JSONB,
+    status VARCHAR(50) DEFAULT 'pending',
+    error_message TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+-- Create file_issues table
+CREATE TABLE IF NOT EXISTS file_issues (
+    id SERIAL PRIMARY KEY,
+    project_uuid UUID NOT NULL REFERENCES projects(uuid),
+    file_id INTEGER NOT NULL REFERENCES project_files(id) ON DELETE CASCADE,
+    filename VARCHAR(500) NOT NULL,
+    name VARCHAR(500) NOT NULL,
+    description TEXT,
+    recommendation TEXT,
+    line_start INTEGER,
+    line_end INTEGER,
+    column_start INTEGER,
+    column_end INTEGER,
+    severity VARCHAR(20) NOT NULL DEFAULT 'medium',
+    state VARCHAR(20) NOT NULL DEFAULT 'suspicion',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create file_issue_history table
+CREATE TABLE IF NOT EXISTS file_issue_history (
+    id SERIAL PRIMARY KEY,
+    issue_id INTEGER NOT NULL REFERENCES file_issues(id) ON DELETE CASCADE,
+    project_uuid UUID NOT NULL REFERENCES projects(uuid),
+    old_state VARCHAR(20) NOT NULL,
+    new_state VARCHAR(20) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    supporting_issue_ids INTEGER[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Actual load reported with the test results
+ALTER TABLE test_results ADD COLUMN IF NOT EXISTS test_duration_seconds DOUBLE PRECISION;
+ALTER TABLE test_results ADD COLUMN IF NOT EXISTS achieved_rps DOUBLE PRECISION;
+ALTER TABLE test_results ADD COLUMN IF NOT EXISTS stages JSONB;
+
+-- Create endpoint_metrics table
+CREATE TABLE IF NOT EXISTS endpoint_metrics (
+    id SERIAL PRIMARY KEY,
+    test_result_id INTEGER NOT NULL REFERENCES test_results(id) ON DELETE CASCADE,
+    project_uuid UUID NOT NULL REFERENCES projects(uuid),
+    name VARCHAR(500) NOT NULL,
+    method VARCHAR(20) NOT NULL DEFAULT '',
+    p50 DOUBLE PRECISION,
+    p90 DOUBLE PRECISION,
+    p95 DOUBLE PRECISION,
+    p99 DOUBLE PRECISION,
+    max DOUBLE PRECISION,
+    rps DOUBLE PRECISION,
+    requests INTEGER NOT NULL DEFAULT 0,
+    errors INTEGER NOT NULL DEFAULT 0,
+    error_counts JSONB,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(test_result_id, method, name)
+);
+
+-- Percentiles computed from raw samples keep their HDR histogram
+ALTER TABLE endpoint_metrics ADD COLUMN IF NOT EXISTS percentiles_source VARCHAR(20) NOT NULL DEFAULT 'reported';
+ALTER TABLE endpoint_metrics ADD COLUMN IF NOT EXISTS latency_histogram JSONB;
+
+-- Create metric_intervals table
+CREATE TABLE IF NOT EXISTS metric_intervals (
+    id SERIAL PRIMARY KEY,
+    test_result_id INTEGER NOT NULL REFERENCES test_results(id) ON DELETE CASCADE,
+    project_uuid UUID NOT NULL REFERENCES projects(uuid),
+    start_time TIMESTAMPTZ NOT NULL,
+    duration_seconds DOUBLE PRECISION NOT NULL,
+    rps DOUBLE PRECISION,
+    active_vus INTEGER,
+    p50 DOUBLE PRECISION,
+    p90 DOUBLE PRECISION,
+    p95 DOUBLE PRECISION,
+    p99 DOUBLE PRECISION,
+    requests INTEGER NOT NULL DEFAULT 0,
+    errors INTEGER NOT NULL DEFAULT 0,
+    UNIQUE(test_result_id, start_time)
+);
+
+-- Create baselines table: the run new runs of a tenant/repo are compared against
+CREATE TABLE IF NOT EXISTS baselines (
+    id SERIAL PRIMARY KEY,
+    tenant VARCHAR(255) NOT NULL,
+    repo VARCHAR(255) NOT NULL,
+    project_uuid UUID NOT NULL REFERENCES projects(uuid),
+    test_result_id INTEGER NOT NULL REFERENCES test_results(id) ON DELETE CASCADE,
+    tolerances JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(tenant, repo)
+);
+
+-- Create jobs table: the durable queue of background work shared by all server instances
+CREATE TABLE IF NOT EXISTS jobs (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(50) NOT NULL, -- final_analysis, input_review, file_analysis
+    project_uuid UUID NOT NULL REFERENCES projects(uuid),
+    status VARCHAR(20) NOT NULL DEFAULT 'queued', -- queued, running, done, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 3,
+    next_run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_by VARCHAR(255),
+    lease_expires_at TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMP;
+-- file_analysis jobs work on one file of the project
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS file_id INTEGER REFERENCES project_files(id) ON DELETE CASCADE;
+
+-- Files are analysed in the background; files stored before that were analysed on upload
+ALTER TABLE project_files ADD COLUMN IF NOT EXISTS analysis_status VARCHAR(20) NOT NULL DEFAULT 'done'; -- queued, analyzing, done, failed
+ALTER TABLE project_files ADD COLUMN IF NOT EXISTS analysis_error TEXT;
+
+-- Projects follow a state machine; projects stored before that take the state of their analysis
+ALTER TABLE projects ALTER COLUMN status SET DEFAULT 'collecting';
+UPDATE projects p
+SET status = CASE ar.status
+        WHEN 'completed' THEN 'completed'
+        WHEN 'failed' THEN 'failed'
+        WHEN 'processing' THEN 'analyzing'
+        ELSE 'collecting'
+    END
+FROM analysis_results ar
+WHERE ar.project_uuid = p.uuid AND p.status IN ('initialized', 'results_received');
+UPDATE projects SET status = 'collecting' WHERE status IN ('initialized', 'results_received');
+
+-- Create analysis_attempts table: the log of failed attempts of the analysis stages
+CREATE TABLE IF NOT EXISTS analysis_attempts (
+    id SERIAL PRIMARY KEY,
+    project_uuid UUID NOT NULL REFERENCES projects(uuid),
+    stage VARCHAR(50) NOT NULL, -- prepare, ai_analysis, save_results, file_analysis
+    attempt INTEGER NOT NULL,
+    error_message TEXT NOT NULL,
+    transient BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Create indexes for better performance
 CREATE INDEX IF NOT EXISTS idx_projects_uuid ON projects(uuid);
 CREATE INDEX IF NOT EXISTS idx_projects_tenant_repo ON projects(tenant, repo);
+CREATE INDEX IF NOT EXISTS idx_projects_status ON projects(status);
 CREATE INDEX IF NOT EXISTS idx_project_files_uuid ON project_files(project_uuid);
 CREATE INDEX IF NOT EXISTS idx_test_results_uuid ON test_results(project_uuid);
 CREATE INDEX IF NOT EXISTS idx_analysis_results_uuid ON analysis_results(project_uuid);
 CREATE INDEX IF NOT EXISTS idx_analysis_results_status ON analysis_results(status);
+CREATE INDEX IF NOT EXISTS idx_input_reviews_uuid ON input_reviews(project_uuid);
+CREATE INDEX IF NOT EXISTS idx_file_issues_uuid ON file_issues(project_uuid);
+CREATE INDEX IF NOT EXISTS idx_file_issues_file_id ON file_issues(file_id);
+CREATE INDEX IF NOT EXISTS idx_file_issues_severity_state ON file_issues(project_uuid, severity, state);
+CREATE INDEX IF NOT EXISTS idx_file_issue_history_uuid ON file_issue_history(project_uuid);
+CREATE INDEX IF NOT EXISTS idx_endpoint_metrics_uuid ON endpoint_metrics(project_uuid);
+CREATE INDEX IF NOT EXISTS idx_endpoint_metrics_endpoint ON endpoint_metrics(method, name);
+CREATE INDEX IF NOT EXISTS idx_metric_intervals_result ON metric_intervals(test_result_id, start_time);
+CREATE INDEX IF NOT EXISTS idx_jobs_due ON jobs(status, next_run_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_project ON jobs(project_uuid, kind);
+-- A project (or a file of it) has at most one job of a kind waiting to run
+CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_queued_once ON jobs(kind, project_uuid, COALESCE(file_id, 0)) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_analysis_attempts_uuid ON analysis_attempts(project_uuid, stage);
+CREATE INDEX IF NOT EXISTS idx_project_files_status ON project_files(project_uuid, analysis_status);
 
 -- Create trigger to update updated_at timestamp
 CREATE OR REPLACE FUNCTION update_updated_at_column()
@@ -73,3 +237,7 @@ $$ language 'plpgsql';
 DROP TRIGGER IF EXISTS update_projects_updated_at ON projects;
 CREATE TRIGGER update_projects_updated_at BEFORE UPDATE ON projects
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS update_file_issues_updated_at ON file_issues;
+CREATE TRIGGER update_file_issues_updated_at BEFORE UPDATE ON file_issues
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -3,11 +3,14 @@ package handlers
 import (
         "context"
         "encoding/json"
+        "errors"
         "net/http"
+        "strings"
         "time"
 
         "github.com/gin-gonic/gin"
         "github.com/google/uuid"
+        "github.com/jackc/pgx/v5"
         "github.com/jackc/pgx/v5/pgxpool"
         "github.com/performance-analyzer/models"
         "github.com/performance-analyzer/services"
@@ -27,6 +30,8 @@ func New(db *pgxpool.Pool, analyzer *services.Analyzer) *Handler {
 }
 
 func (h *Handler) InitAnalyze(c *gin.Context) {
+        ctx := c.Request.Context()
+
         tenant := c.Param("tenant")
         repo := c.Param("repo")
         uuidParam := c.Param("uuid")
@@ -71,21 +76,30 @@ func (h *Handler) InitAnalyze(c *gin.Context) {
 
         // Check if project already exists
         var existingID int
-        err = h.db.QueryRow(context.Background(), 
+        err = h.db.QueryRow(ctx, 
                 "SELECT id FROM projects WHERE uuid = $1", projectUUID).Scan(&existingID)
         if err == nil {
                 c.JSON(http.StatusConflict, gin.H{"error": "Project with this UUID already exists"})
                 return
         }
 
+        // Create the project with its analysis and input review records together, so a failed
+        // insert does not leave a project behind that blocks retries with the same UUID
+        tx, err := h.db.Begin(ctx)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction failed: " + err.Error()})
+                return
+        }
+        defer tx.Rollback(ctx)
+
         // Insert project into database
         query := `
                 INSERT INTO projects (tenant, repo, uuid, language, testing_tool, project_info, files_count, status)
-                VALUES ($1, $2, $3, $4, $5, $6, $7, 'initialized')
+                VALUES ($1, $2, $3, $4, $5, $6, $7, 'collecting')
                 RETURNING id`
         
         var projectID int
-        err = h.db.QueryRow(context.Background(), query, 
+        err = tx.QueryRow(ctx, query, 
                 tenant, repo, projectUUID, req.Language, req.TestingTool, req.ProjectInfo, req.FilesCount).Scan(&projectID)
         if err != nil {
                 c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create project: " + err.Error()})
@@ -93,7 +107,7 @@ func (h *Handler) InitAnalyze(c *gin.Context) {
         }
 
         // Initialize analysis result record
-        _, err = h.db.Exec(context.Background(),
+        _, err = tx.Exec(ctx,
                 "INSERT INTO analysis_results (project_uuid, status) VALUES ($1, 'pending')",
                 projectUUID)
         if err != nil {
@@ -101,15 +115,38 @@ func (h *Handler) InitAnalyze(c *gin.Context) {
                 return
         }
 
+        // Initialize input review record
+        _, err = tx.Exec(ctx,
+                "INSERT INTO input_reviews (project_uuid, status) VALUES ($1, 'pending')",
+                projectUUID)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initialize input review: " + err.Error()})
+                return
+        }
+
+        if err = tx.Commit(ctx); err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+                return
+        }
+
+        // Start reviewing the test parameters
+        if err := h.analyzer.TriggerInputReview(ctx, projectUUID); err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue input review: " + err.Error()})
+                return
+        }
+
         c.JSON(http.StatusCreated, gin.H{
-                "message":     "Analysis initialized successfully",
-                "project_id":  projectID,
-                "uuid":        projectUUID,
-                "files_count": req.FilesCount,
+                "message":             "Analysis initialized successfully",
+                "project_id":          projectID,
+                "uuid":                projectUUID,
+                "files_count":         req.FilesCount,
+                "input_review_status": "pending",
         })
 }
 
 func (h *Handler) SendFile(c *gin.Context) {
+        ctx := c.Request.Context()
+
         uuidParam := c.Param("uuid")
 
         // Validate UUID
@@ -136,55 +173,53 @@ func (h *Handler) SendFile(c *gin.Context) {
                 return
         }
 
-        // Check if project exists
-        var projectExists bool
-        err = h.db.QueryRow(context.Background(),
-                "SELECT EXISTS(SELECT 1 FROM projects WHERE uuid = $1)", projectUUID).Scan(&projectExists)
+        // Insert or update file and increment counter
+        tx, err := h.db.Begin(ctx)
         if err != nil {
-                c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction failed: " + err.Error()})
                 return
         }
-        if !projectExists {
+        defer tx.Rollback(ctx)
+
+        // Files are accepted only while the project is collecting; the lock keeps it from
+        // becoming ready before the file is stored
+        err = h.analyzer.LockCollectingProject(ctx, tx, projectUUID, "upload files")
+        var stateErr *services.StateError
+        if errors.Is(err, pgx.ErrNoRows) {
                 c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
                 return
-        }
-
-        // Request AI analysis for the file
-        fileAnalysis, err := h.analyzer.AnalyzeFile(req.Content)
-        if err != nil {
-                // Log error but continue - we'll store the file without analysis
-                errorAnalysis := map[string]interface{}{
-                        "error":       "AI analysis failed",
-                        "message":     err.Error(),
-                        "analyzed_at": time.Now(),
-                        "file_size":   len(req.Content),
-                }
-                fileAnalysisBytes, _ := json.Marshal(errorAnalysis)
-                fileAnalysis = json.RawMessage(fileAnalysisBytes)
-        }
-
-        // Insert or update file and increment counter
-        tx, err := h.db.Begin(context.Background())
-        if err != nil {
-                c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction failed: " + err.Error()})
+        } else if errors.As(err, &stateErr) {
+                c.JSON(http.StatusConflict, gin.H{"error": stateErr.Error(), "status": stateErr.State})
+                return
+        } else if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
                 return
         }
-        defer tx.Rollback(context.Background())
 
-        // Insert/update file
+        // Insert/update file; it is analysed by the background workers
         fileQuery := `
-                INSERT INTO project_files (project_uuid, filename, content, file_analysis)
-                VALUES ($1, $2, $3, $4)
+                INSERT INTO project_files (project_uuid, filename, content, analysis_status)
+                VALUES ($1, $2, $3, 'queued')
                 ON CONFLICT (project_uuid, filename)
-                DO UPDATE SET content = EXCLUDED.content, file_analysis = EXCLUDED.file_analysis`
+                DO UPDATE SET content = EXCLUDED.content, file_analysis = NULL,
+                              analysis_status = 'queued', analysis_error = NULL
+                RETURNING id`
         
-        _, err = tx.Exec(context.Background(), fileQuery,
-                projectUUID, req.Filename, req.Content, fileAnalysis)
+        var fileID int
+        err = tx.QueryRow(ctx, fileQuery,
+                projectUUID, req.Filename, req.Content).Scan(&fileID)
         if err != nil {
                 c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file: " + err.Error()})
                 return
         }
 
+        // Replace issues found in the previous version of the file
+        _, err = tx.Exec(ctx, "DELETE FROM file_issues WHERE file_id = $1", fileID)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear file issues: " + err.Error()})
+                return
+        }
+
         // Increment received files count (only if it's a new file)
         countQuery := `
                 UPDATE projects 
@@ -195,39 +230,41 @@ func (h *Handler) SendFile(c *gin.Context) {
                 ),
                 updated_at = CURRENT_TIMESTAMP
                 WHERE uuid = $1
-                RETURNING files_count, received_files_count, has_test_results`
+                RETURNING files_count, received_files_count`
         
         var filesCount, receivedFilesCount int
-        var hasTestResults bool
-        err = tx.QueryRow(context.Background(), countQuery, projectUUID).Scan(&filesCount, &receivedFilesCount, &hasTestResults)
+        err = tx.QueryRow(ctx, countQuery, projectUUID).Scan(&filesCount, &receivedFilesCount)
         if err != nil {
                 c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update files count: " + err.Error()})
                 return
         }
 
         // Commit transaction
-        if err = tx.Commit(context.Background()); err != nil {
+        if err = tx.Commit(ctx); err != nil {
                 c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
                 return
         }
 
-        // Check if we should trigger analysis
-        shouldTriggerAnalysis := receivedFilesCount >= filesCount && hasTestResults
-        if shouldTriggerAnalysis {
-                h.analyzer.TriggerFinalAnalysis(projectUUID)
+        // Analyse the file in the background; the last analysed file queues the final analysis
+        if err := h.analyzer.TriggerFileAnalysis(ctx, projectUUID, fileID); err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue file analysis: " + err.Error()})
+                return
         }
 
-        c.JSON(http.StatusOK, gin.H{
-                "message":              "File received and analyzed successfully",
+        c.JSON(http.StatusAccepted, gin.H{
+                "message":              "File received, analysis queued",
                 "filename":             req.Filename,
+                "file_id":              fileID,
                 "uuid":                 projectUUID,
+                "analysis_status":      models.FileAnalysisQueued,
                 "received_files_count": receivedFilesCount,
                 "total_files_count":    filesCount,
-                "ready_for_analysis":   shouldTriggerAnalysis,
         })
 }
 
 func (h *Handler) SendResults(c *gin.Context) {
+        ctx := c.Request.Context()
+
         uuidParam := c.Param("uuid")
 
         // Validate UUID
@@ -237,12 +274,61 @@ func (h *Handler) SendResults(c *gin.Context) {
                 return
         }
 
-        // Parse request body
-        var req models.SendResultsRequest
-        if err := c.ShouldBindJSON(&req); err != nil {
-                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+        // Load project; tool reports are checked against its requirements
+        project, err := h.analyzer.GetProject(ctx, projectUUID)
+        if errors.Is(err, pgx.ErrNoRows) {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
                 return
         }
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+                return
+        }
+        if project.Status != models.ProjectCollecting {
+                c.JSON(http.StatusConflict, gin.H{
+                        "error":  "cannot submit test results: project is " + string(project.Status),
+                        "status": project.Status,
+                })
+                return
+        }
+
+        // Parse request body: our own JSON by default, or a native tool report selected by ?format=.
+        // Non-JSON uploads without a format are read as a report of the project's testing tool.
+        format := strings.ToLower(c.Query("format"))
+        if format == "" {
+                format = "json"
+                switch c.ContentType() {
+                case "text/csv", "text/plain", "text/xml", "application/xml", "application/octet-stream":
+                        format = strings.ToLower(project.TestingTool)
+                }
+        }
+
+        var req models.SendResultsRequest
+        if format == "json" {
+                if err := c.ShouldBindJSON(&req); err != nil {
+                        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+                        return
+                }
+                // Percentiles are marked computed only by the raw samples import, never by the client
+                for i := range req.Endpoints {
+                        req.Endpoints[i].PercentilesSource = models.PercentilesReported
+                }
+        } else {
+                parser, ok := services.LookupResultsParser(format)
+                if !ok {
+                        c.JSON(http.StatusBadRequest, gin.H{
+                                "error":             "Unsupported results format: " + format,
+                                "supported_formats": append([]string{"json"}, services.ResultsFormats()...),
+                        })
+                        return
+                }
+                parsed, err := parser.Parse(c.Request.Body, project)
+                if err != nil {
+                        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + format + " results: " + err.Error()})
+                        return
+                }
+                req = *parsed
+        }
 
         // Validate required fields
         if req.SuccessfulCalls < 0 || req.FailedCalls < 0 {
@@ -250,16 +336,41 @@ func (h *Handler) SendResults(c *gin.Context) {
                 return
         }
 
-        // Check if project exists
-        var projectExists bool
-        err = h.db.QueryRow(context.Background(),
-                "SELECT EXISTS(SELECT 1 FROM projects WHERE uuid = $1)", projectUUID).Scan(&projectExists)
-        if err != nil {
-                c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+        // Validate actual load fields
+        var testDurationSeconds *float64
+        if len(req.TestDuration) > 0 && string(req.TestDuration) != "null" {
+                duration, err := services.ParseDurationValue(req.TestDuration)
+                if err != nil {
+                        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid test_duration: " + err.Error()})
+                        return
+                }
+                seconds := duration.Seconds()
+                testDurationSeconds = &seconds
+        }
+        if req.AchievedRPS != nil && *req.AchievedRPS < 0 {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Achieved RPS cannot be negative"})
                 return
         }
-        if !projectExists {
-                c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        var stagesJSON []byte
+        if len(req.Stages) > 0 {
+                for _, stage := range req.Stages {
+                        if stage.AchievedRPS < 0 || stage.AchievedVUs < 0 {
+                                c.JSON(http.StatusBadRequest, gin.H{"error": "Stage metrics cannot be negative"})
+                                return
+                        }
+                }
+                stagesJSON, _ = json.Marshal(req.Stages)
+        }
+
+        // Validate per-endpoint metrics
+        if err := services.NormalizeEndpointMetrics(&req); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid endpoint metrics: " + err.Error()})
+                return
+        }
+
+        // Validate the time series
+        if err := services.NormalizeIntervals(&req); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid intervals: " + err.Error()})
                 return
         }
 
@@ -275,45 +386,109 @@ func (h *Handler) SendResults(c *gin.Context) {
         }
         rawResultsJSON, _ := json.Marshal(rawResults)
 
-        // Insert test results
+        // Insert test results together with their endpoint metrics and time series
+        tx, err := h.db.Begin(ctx)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction failed: " + err.Error()})
+                return
+        }
+        defer tx.Rollback(ctx)
+
+        // Check the state again under the lock, as the project may have moved on meanwhile
+        err = h.analyzer.LockCollectingProject(ctx, tx, projectUUID, "submit test results")
+        var stateErr *services.StateError
+        if errors.As(err, &stateErr) {
+                c.JSON(http.StatusConflict, gin.H{"error": stateErr.Error(), "status": stateErr.State})
+                return
+        } else if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+                return
+        }
+
         query := `
                 INSERT INTO test_results (project_uuid, response_time_p95, response_time_p99, 
-                                         successful_calls, failed_calls, nonfunctional_requirements, raw_results)
-                VALUES ($1, $2, $3, $4, $5, $6, $7)`
+                                         successful_calls, failed_calls, nonfunctional_requirements, raw_results,
+                                         test_duration_seconds, achieved_rps, stages)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+                RETURNING id`
         
-        _, err = h.db.Exec(context.Background(), query,
+        var testResultID int
+        err = tx.QueryRow(ctx, query,
                 projectUUID, req.ResponseTimeP95, req.ResponseTimeP99,
-                req.SuccessfulCalls, req.FailedCalls, req.NonfunctionalRequirements, rawResultsJSON)
+                req.SuccessfulCalls, req.FailedCalls, req.NonfunctionalRequirements, rawResultsJSON,
+                testDurationSeconds, req.AchievedRPS, stagesJSON).Scan(&testResultID)
         if err != nil {
                 c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save test results: " + err.Error()})
                 return
         }
 
-        // Update project status to indicate results received and check if ready for analysis
+        endpointQuery := `
+                INSERT INTO endpoint_metrics (test_result_id, project_uuid, name, method,
+                                              p50, p90, p95, p99, max, rps, requests, errors, error_counts,
+                                              percentiles_source, latency_histogram)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
+
+        for _, endpoint := range req.Endpoints {
+                _, err = tx.Exec(ctx, endpointQuery,
+                        testResultID, projectUUID, endpoint.Name, endpoint.Method,
+                        endpoint.P50, endpoint.P90, endpoint.P95, endpoint.P99, endpoint.Max, endpoint.RPS,
+                        endpoint.Requests, endpoint.Errors, endpoint.ErrorCounts,
+                        endpoint.PercentilesSource, endpoint.Histogram)
+                if err != nil {
+                        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save endpoint metrics: " + err.Error()})
+                        return
+                }
+        }
+
+        intervalQuery := `
+                INSERT INTO metric_intervals (test_result_id, project_uuid, start_time, duration_seconds,
+                                              rps, active_vus, p50, p90, p95, p99, requests, errors)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+        for _, interval := range req.Intervals {
+                _, err = tx.Exec(ctx, intervalQuery,
+                        testResultID, projectUUID, interval.Start, interval.DurationSeconds,
+                        interval.RPS, interval.ActiveVUs, interval.P50, interval.P90, interval.P95, interval.P99,
+                        interval.Requests, interval.Errors)
+                if err != nil {
+                        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save metric intervals: " + err.Error()})
+                        return
+                }
+        }
+
+        // Mark the results as received and check if ready for analysis
         updateQuery := `
                 UPDATE projects 
-                SET status = 'results_received', 
-                    has_test_results = true, 
+                SET has_test_results = true, 
                     updated_at = CURRENT_TIMESTAMP 
                 WHERE uuid = $1
                 RETURNING files_count, received_files_count`
         
         var filesCount, receivedFilesCount int
-        err = h.db.QueryRow(context.Background(), updateQuery, projectUUID).Scan(&filesCount, &receivedFilesCount)
+        err = tx.QueryRow(ctx, updateQuery, projectUUID).Scan(&filesCount, &receivedFilesCount)
         if err != nil {
                 c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project status: " + err.Error()})
                 return
         }
 
-        // Trigger final analysis if all files are received
-        shouldTriggerAnalysis := receivedFilesCount >= filesCount
-        if shouldTriggerAnalysis {
-                h.analyzer.TriggerFinalAnalysis(projectUUID)
+        if err = tx.Commit(ctx); err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+                return
+        }
+
+        // Trigger final analysis if all files are received and analysed
+        shouldTriggerAnalysis, err := h.analyzer.TriggerFinalAnalysisIfReady(ctx, projectUUID)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue analysis: " + err.Error()})
+                return
         }
 
         c.JSON(http.StatusOK, gin.H{
                 "message":              "Test results received successfully",
                 "uuid":                 projectUUID,
+                "format":               format,
+                "endpoints_count":      len(req.Endpoints),
+                "intervals_count":      len(req.Intervals),
                 "received_files_count": receivedFilesCount,
                 "total_files_count":    filesCount,
                 "ready_for_analysis":   shouldTriggerAnalysis,
@@ -321,6 +496,8 @@ func (h *Handler) SendResults(c *gin.Context) {
 }
 
 func (h *Handler) GetAnalyzeResults(c *gin.Context) {
+        ctx := c.Request.Context()
+
         uuidParam := c.Param("uuid")
 
         // Validate UUID
@@ -330,6 +507,13 @@ func (h *Handler) GetAnalyzeResults(c *gin.Context) {
                 return
         }
 
+        // Parse issue filters
+        filter, err := services.ParseFileIssueFilter(c.Query("severity"), c.Query("state"))
+        if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid issue filter: " + err.Error()})
+                return
+        }
+
         // Get analysis result
         var result models.AnalysisResult
         query := `
@@ -339,7 +523,7 @@ func (h *Handler) GetAnalyzeResults(c *gin.Context) {
                 ORDER BY created_at DESC
                 LIMIT 1`
         
-        err = h.db.QueryRow(context.Background(), query, projectUUID).Scan(
+        err = h.db.QueryRow(ctx, query, projectUUID).Scan(
                 &result.ID, &result.ProjectUUID, &result.FinalAnalysis,
                 &result.Status, &result.ErrorMessage, &result.CreatedAt, &result.CompletedAt)
         if err != nil {
@@ -347,14 +531,55 @@ func (h *Handler) GetAnalyzeResults(c *gin.Context) {
                 return
         }
 
+        // The project state tells a pending analysis apart from one that will not run
+        projectState, err := h.analyzer.GetProjectState(ctx, projectUUID)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project state: " + err.Error()})
+                return
+        }
+        if projectState == models.ProjectCancelled {
+                c.JSON(http.StatusConflict, gin.H{
+                        "status": projectState,
+                        "error":  "Analysis was cancelled",
+                        "uuid":   projectUUID,
+                })
+                return
+        }
+
+        // Get input parameters review
+        inputReview := h.getInputReview(ctx, projectUUID)
+
+        // Get the log of failed attempts of the analysis stages
+        attempts, err := h.analyzer.GetAnalysisAttempts(ctx, projectUUID)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get analysis attempts: " + err.Error()})
+                return
+        }
+
+        // Get the progress of the file analyses
+        files, err := h.analyzer.GetFileStatuses(ctx, projectUUID)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file statuses: " + err.Error()})
+                return
+        }
+
         // Check status
         switch result.Status {
         case "pending", "processing":
-                c.JSON(http.StatusAccepted, gin.H{
-                        "status":  result.Status,
-                        "message": "Analysis is still in progress",
-                        "uuid":    projectUUID,
-                })
+                response := gin.H{
+                        "status":         result.Status,
+                        "project_status": projectState,
+                        "message":        "Analysis is still in progress",
+                        "uuid":           projectUUID,
+                        "input_review":   inputReview,
+                        "files":          files,
+                        "attempts":       attempts,
+                }
+                if result.ErrorMessage != nil {
+                        // The last attempt failed with a transient error and a retry is scheduled
+                        response["last_error"] = *result.ErrorMessage
+                }
+                c.JSON(http.StatusAccepted, response)
                 return
         case "completed":
                 // Return full analysis results
@@ -363,10 +588,20 @@ func (h *Handler) GetAnalyzeResults(c *gin.Context) {
                         json.Unmarshal(result.FinalAnalysis, &analysisData)
                 }
 
+                // File issues are read live so state changes made after the report are visible
+                fileIssues, err := h.analyzer.GetFileIssues(ctx, projectUUID, filter)
+                if err != nil {
+                        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file issues: " + err.Error()})
+                        return
+                }
+
                 response := gin.H{
                         "uuid":         projectUUID,
                         "status":       result.Status,
                         "analysis":     analysisData,
+                        "input_review": inputReview,
+                        "file_issues":  fileIssues,
+                        "attempts":     attempts,
                         "completed_at": result.CompletedAt,
                 }
 
@@ -378,9 +613,10 @@ func (h *Handler) GetAnalyzeResults(c *gin.Context) {
                         errorMsg = *result.ErrorMessage
                 }
                 c.JSON(http.StatusInternalServerError, gin.H{
-                        "status":  result.Status,
-                        "error":   errorMsg,
-                        "uuid":    projectUUID,
+                        "status":   result.Status,
+                        "error":    errorMsg,
+                        "uuid":     projectUUID,
+                        "attempts": attempts,
                 })
                 return
         default:
@@ -391,3 +627,245 @@ func (h *Handler) GetAnalyzeResults(c *gin.Context) {
                 return
         }
 }
+
+// CancelAnalyze stops a project that has not finished; its queued work is dropped and no
+// more files or results are accepted
+func (h *Handler) CancelAnalyze(c *gin.Context) {
+        ctx := c.Request.Context()
+
+        projectUUID, err := uuid.Parse(c.Param("uuid"))
+        if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+                return
+        }
+
+        err = h.analyzer.CancelProject(ctx, projectUUID)
+        var stateErr *services.StateError
+        if errors.Is(err, pgx.ErrNoRows) {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+                return
+        } else if errors.As(err, &stateErr) {
+                c.JSON(http.StatusConflict, gin.H{"error": stateErr.Error(), "status": stateErr.State})
+                return
+        } else if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel analysis: " + err.Error()})
+                return
+        }
+
+        c.JSON(http.StatusOK, gin.H{
+                "message": "Analysis cancelled",
+                "uuid":    projectUUID,
+                "status":  models.ProjectCancelled,
+        })
+}
+
+func (h *Handler) GetFileIssues(c *gin.Context) {
+        ctx := c.Request.Context()
+
+        uuidParam := c.Param("uuid")
+
+        // Validate UUID
+        projectUUID, err := uuid.Parse(uuidParam)
+        if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+                return
+        }
+
+        // Parse issue filters
+        filter, err := services.ParseFileIssueFilter(c.Query("severity"), c.Query("state"))
+        if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid issue filter: " + err.Error()})
+                return
+        }
+
+        // Check if project exists
+        var projectExists bool
+        err = h.db.QueryRow(ctx,
+                "SELECT EXISTS(SELECT 1 FROM projects WHERE uuid = $1)", projectUUID).Scan(&projectExists)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+                return
+        }
+        if !projectExists {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+                return
+        }
+
+        issues, err := h.analyzer.GetFileIssues(ctx, projectUUID, filter)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file issues: " + err.Error()})
+                return
+        }
+
+        history, err := h.analyzer.GetFileIssueHistory(ctx, projectUUID)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file issue history: " + err.Error()})
+                return
+        }
+
+        c.JSON(http.StatusOK, gin.H{
+                "uuid":    projectUUID,
+                "count":   len(issues),
+                "issues":  issues,
+                "history": history,
+        })
+}
+
+// SetBaseline marks the latest test results of a project as the baseline its tenant/repo
+// is compared against
+func (h *Handler) SetBaseline(c *gin.Context) {
+        ctx := c.Request.Context()
+
+        uuidParam := c.Param("uuid")
+
+        // Validate UUID
+        projectUUID, err := uuid.Parse(uuidParam)
+        if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+                return
+        }
+
+        // The body with tolerances is optional
+        var req models.SetBaselineRequest
+        if c.Request.ContentLength != 0 {
+                if err := c.ShouldBindJSON(&req); err != nil {
+                        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+                        return
+                }
+        }
+        tolerances, err := services.NormalizeRegressionTolerances(req.Tolerances)
+        if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tolerances: " + err.Error()})
+                return
+        }
+
+        project, err := h.analyzer.GetProject(ctx, projectUUID)
+        if errors.Is(err, pgx.ErrNoRows) {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+                return
+        }
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+                return
+        }
+
+        baseline, err := h.analyzer.SetBaseline(ctx, project, tolerances)
+        if errors.Is(err, pgx.ErrNoRows) {
+                c.JSON(http.StatusConflict, gin.H{"error": "Project has no test results"})
+                return
+        }
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set baseline: " + err.Error()})
+                return
+        }
+
+        c.JSON(http.StatusOK, gin.H{
+                "message":  "Baseline set successfully",
+                "baseline": baseline,
+        })
+}
+
+// Compare returns a structured diff of two runs; narrative=true adds an AI explanation of the changes
+func (h *Handler) Compare(c *gin.Context) {
+        ctx := c.Request.Context()
+
+        // Validate UUIDs
+        uuidA, err := uuid.Parse(c.Param("uuidA"))
+        if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format: " + c.Param("uuidA")})
+                return
+        }
+        uuidB, err := uuid.Parse(c.Param("uuidB"))
+        if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format: " + c.Param("uuidB")})
+                return
+        }
+        narrative := c.Query("narrative") == "true" || c.Query("narrative") == "1"
+
+        var projects []*models.Project
+        for _, projectUUID := range []uuid.UUID{uuidA, uuidB} {
+                project, err := h.analyzer.GetProject(ctx, projectUUID)
+                if errors.Is(err, pgx.ErrNoRows) {
+                        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found", "uuid": projectUUID})
+                        return
+                }
+                if err != nil {
+                        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+                        return
+                }
+                projects = append(projects, project)
+        }
+
+        comparison, err := h.analyzer.CompareProjects(ctx, projects[0], projects[1], narrative)
+        if errors.Is(err, pgx.ErrNoRows) {
+                c.JSON(http.StatusConflict, gin.H{"error": "Both projects must have test results"})
+                return
+        }
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compare runs: " + err.Error()})
+                return
+        }
+
+        c.JSON(http.StatusOK, comparison)
+}
+
+// GetTrend returns the history of the runs of a tenant/repo, optionally limited to a date range
+func (h *Handler) GetTrend(c *gin.Context) {
+        ctx := c.Request.Context()
+
+        tenant := c.Param("tenant")
+        repo := c.Param("repo")
+
+        // Validate tenant and repo
+        if err := utils.ValidateString(tenant, 1, 255); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant: " + err.Error()})
+                return
+        }
+        if err := utils.ValidateString(repo, 1, 255); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repo: " + err.Error()})
+                return
+        }
+
+        // Parse date range
+        from, to, err := services.ParseTrendRange(c.Query("from"), c.Query("to"))
+        if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date range: " + err.Error()})
+                return
+        }
+
+        trend, err := h.analyzer.GetRepoTrend(ctx, tenant, repo, from, to)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get trend: " + err.Error()})
+                return
+        }
+
+        c.JSON(http.StatusOK, trend)
+}
+
+// getInputReview returns the input parameters review in response form, or nil if there is none
+func (h *Handler) getInputReview(ctx context.Context, projectUUID uuid.UUID) gin.H {
+        var review models.InputReview
+        query := `
+                SELECT id, project_uuid, issues, status, error_message, created_at, completed_at
+                FROM input_reviews
+                WHERE project_uuid = $1`
+
+        err := h.db.QueryRow(ctx, query, projectUUID).Scan(
+                &review.ID, &review.ProjectUUID, &review.Issues,
+                &review.Status, &review.ErrorMessage, &review.CreatedAt, &review.CompletedAt)
+        if err != nil {
+                return nil
+        }
+
+        issues := []models.InputIssue{}
+        if review.Issues != nil {
+                json.Unmarshal(review.Issues, &issues)
+        }
+
+        return gin.H{
+                "status":        review.Status,
+                "issues":        issues,
+                "error_message": review.ErrorMessage,
+                "completed_at":  review.CompletedAt,
+        }
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+        "context"
+        "errors"
         "log"
         "net/http"
         "os"
+        "os/signal"
+        "syscall"
+        "time"
 
         "github.com/gin-gonic/gin"
         "github.com/performance-analyzer/config"
@@ -17,24 +22,33 @@ func main() {
         // Initialize configuration
         cfg := config.New()
 
+        // Cancelled on SIGINT/SIGTERM to start the graceful shutdown
+        ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+        defer stop()
+
         // Initialize database connection
-        db, err := database.Connect(cfg.GetDatabaseURL())
+        db, err := database.Connect(ctx, cfg.GetDatabaseURL())
         if err != nil {
                 log.Fatalf("Failed to connect to database: %v", err)
         }
         defer db.Close()
 
         // Run database migrations
-        if err := database.Migrate(db); err != nil {
+        if err := database.Migrate(ctx, db); err != nil {
                 log.Fatalf("Failed to run migrations: %v", err)
         }
 
         // Initialize services
-        aiClient := services.NewAIClient(cfg.GetAIModelURL())
+        aiClient := services.NewAIClient(cfg.GetAIModelURL(), cfg.AIMaxConcurrency, db)
         analyzer := services.NewAnalyzer(db, aiClient)
 
-        // Start background analyzer
-        go analyzer.StartBackgroundProcessor()
+        // Requeue the analyses a crash or a restart left unfinished
+        if _, err := analyzer.RecoverJobs(ctx); err != nil {
+                log.Printf("Failed to recover unfinished analyses: %v", err)
+        }
+
+        // Start background analyzer workers
+        analyzer.StartBackgroundProcessor(cfg.AnalysisWorkers)
 
         // Initialize handlers
         handler := handlers.New(db, analyzer)
@@ -53,6 +67,11 @@ func main() {
                 api.POST("/sendFile/:uuid", handler.SendFile)
                 api.POST("/sendResults/:uuid", handler.SendResults)
                 api.GET("/getAnalizeResults/:uuid", handler.GetAnalyzeResults)
+                api.POST("/cancelAnalize/:uuid", handler.CancelAnalyze)
+                api.GET("/getFileIssues/:uuid", handler.GetFileIssues)
+                api.POST("/setBaseline/:uuid", handler.SetBaseline)
+                api.GET("/compare/:uuidA/:uuidB", handler.Compare)
+                api.GET("/tenants/:tenant/repos/:repo/trend", handler.GetTrend)
         }
 
         // Root endpoint with API documentation
@@ -66,6 +85,11 @@ func main() {
                                 "POST /sendFile/{uuid}":                    "Upload project file for analysis",
                                 "POST /sendResults/{uuid}":                 "Submit performance test results",
                                 "GET /getAnalizeResults/{uuid}":            "Get analysis results",
+                                "POST /cancelAnalize/{uuid}":               "Cancel an unfinished analysis",
+                                "GET /getFileIssues/{uuid}":                "List file issues filtered by severity and state",
+                                "POST /setBaseline/{uuid}":                 "Mark the run as the baseline of its tenant/repo",
+                                "GET /compare/{uuidA}/{uuidB}":             "Diff two analysed runs",
+                                "GET /tenants/{tenant}/repos/{repo}/trend": "History of the runs of a repo",
                                 "GET /health":                              "Health check",
                         },
                         "description": "REST API for performance testing analysis with AI-powered insights",
@@ -83,8 +107,36 @@ func main() {
                 port = "5000"
         }
 
-        log.Printf("Starting server on port %s with detailed HTTP logging enabled", port)
-        if err := router.Run("0.0.0.0:" + port); err != nil {
+        server := &http.Server{
+                Addr:    "0.0.0.0:" + port,
+                Handler: router,
+        }
+
+        serverErr := make(chan error, 1)
+        go func() {
+                log.Printf("Starting server on port %s with detailed HTTP logging enabled", port)
+                if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+                        serverErr <- err
+                }
+        }()
+
+        select {
+        case err := <-serverErr:
                 log.Fatalf("Failed to start server: %v", err)
+        case <-ctx.Done():
+        }
+        stop()
+
+        // Finish in-flight requests, then drain the analyzer workers within the same deadline
+        log.Printf("Shutting down, waiting up to %d seconds for requests and analyses", cfg.ShutdownTimeoutSeconds)
+        shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeoutSeconds)*time.Second)
+        defer cancel()
+
+        if err := server.Shutdown(shutdownCtx); err != nil {
+                log.Printf("HTTP server shutdown: %v", err)
+        }
+        if err := analyzer.Shutdown(shutdownCtx); err != nil {
+                log.Printf("Analyzer shutdown: %v", err)
         }
+        log.Println("Server stopped")
 }
@@ -12,6 +12,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// maxLoggedBodySize is the largest request body that is read into memory for logging
+const maxLoggedBodySize = 1 << 20
+
 // ResponseWriter wrapper to capture response body
 type responseWriter struct {
 	gin.ResponseWriter
@@ -62,8 +65,12 @@ func DetailedHTTPLogger() gin.HandlerFunc {
 }
 
 func logRequest(c *gin.Context) {
+	// Only small JSON bodies are buffered for logging; result files are streamed by the handlers
+	isJSON := strings.Contains(c.GetHeader("Content-Type"), "application/json")
+	loggable := isJSON && c.Request.ContentLength >= 0 && c.Request.ContentLength <= maxLoggedBodySize
+
 	var bodyBytes []byte
-	if c.Request.Body != nil {
+	if c.Request.Body != nil && loggable {
 		bodyBytes, _ = io.ReadAll(c.Request.Body)
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 	}
@@ -84,6 +91,8 @@ func logRequest(c *gin.Context) {
 	if requestBody != nil {
 		requestBodyJSON, _ := json.MarshalIndent(requestBody, "", "  ")
 		log.Printf("Body: %s", string(requestBodyJSON))
+	} else if c.Request.Body != nil && !loggable && c.Request.ContentLength != 0 {
+		log.Printf("Body: [not logged, %d bytes, %s]", c.Request.ContentLength, c.GetHeader("Content-Type"))
 	}
 	log.Printf("Client IP: %s", c.ClientIP())
 	log.Printf("User Agent: %s", c.Request.UserAgent())
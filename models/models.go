@@ -18,18 +18,156 @@ type Project struct {
         FilesCount          int             `json:"files_count" db:"files_count"`
         ReceivedFilesCount  int             `json:"received_files_count" db:"received_files_count"`
         HasTestResults      bool            `json:"has_test_results" db:"has_test_results"`
-        Status              string          `json:"status" db:"status"`
+        Status              ProjectState    `json:"status" db:"status"`
         CreatedAt           time.Time       `json:"created_at" db:"created_at"`
         UpdatedAt           time.Time       `json:"updated_at" db:"updated_at"`
 }
 
+// ProjectState is the stage of its lifecycle a project is in. A project collects its files and
+// test results, becomes ready once they are all in and analysed, and is then analysed once.
+type ProjectState string
+
+// Project states
+const (
+        ProjectCollecting ProjectState = "collecting"
+        ProjectReady      ProjectState = "ready"
+        ProjectAnalyzing  ProjectState = "analyzing"
+        ProjectCompleted  ProjectState = "completed"
+        ProjectFailed     ProjectState = "failed"
+        ProjectCancelled  ProjectState = "cancelled"
+)
+
+// projectTransitions lists the states a project may move to from each state. An analyzing
+// project moves to analyzing again when a worker takes over the analysis of a dead one, and
+// back to ready when a transient failure queues the analysis again. Completed, failed and
+// cancelled are final.
+var projectTransitions = map[ProjectState][]ProjectState{
+        ProjectCollecting: {ProjectReady, ProjectCancelled},
+        ProjectReady:      {ProjectAnalyzing, ProjectFailed, ProjectCancelled},
+        ProjectAnalyzing:  {ProjectAnalyzing, ProjectReady, ProjectCompleted, ProjectFailed, ProjectCancelled},
+}
+
+// CanTransitionTo tells whether a project in state s may move to next
+func (s ProjectState) CanTransitionTo(next ProjectState) bool {
+        for _, state := range projectTransitions[s] {
+                if state == next {
+                        return true
+                }
+        }
+        return false
+}
+
+// ProjectStatesBefore returns the states from which a project may move to next
+func ProjectStatesBefore(next ProjectState) []ProjectState {
+        var states []ProjectState
+        for state := range projectTransitions {
+                if state.CanTransitionTo(next) {
+                        states = append(states, state)
+                }
+        }
+        return states
+}
+
+// ProjectInfo is the typed view of the test input parameters submitted at initAnalize.
+// Fields that clients send in free form are kept raw and interpreted by the services.
+type ProjectInfo struct {
+        Stand                     string          `json:"stand"`
+        ExpectedLoad              json.RawMessage `json:"expected_load"`
+        ExpectedRPS               float64         `json:"expected_rps"`
+        Duration                  json.RawMessage `json:"duration"`
+        Stages                    []LoadStage     `json:"stages"`
+        LoadProfile               json.RawMessage `json:"load_profile"`
+        MaxErrorRatePercent       *float64        `json:"max_error_rate_percent"`
+        NonfunctionalRequirements json.RawMessage `json:"nonfunctional_requirements"`
+}
+
+// LoadStage is a planned ramp stage of the load profile
+type LoadStage struct {
+        Name      string          `json:"name"`
+        Duration  json.RawMessage `json:"duration"`
+        TargetRPS float64         `json:"target_rps"`
+        TargetVUs int             `json:"target_vus"`
+}
+
 type ProjectFile struct {
-        ID           int             `json:"id" db:"id"`
-        ProjectUUID  uuid.UUID       `json:"project_uuid" db:"project_uuid"`
-        Filename     string          `json:"filename" db:"filename"`
-        Content      string          `json:"content" db:"content"`
-        FileAnalysis json.RawMessage `json:"file_analysis" db:"file_analysis"`
-        CreatedAt    time.Time       `json:"created_at" db:"created_at"`
+        ID             int             `json:"id" db:"id"`
+        ProjectUUID    uuid.UUID       `json:"project_uuid" db:"project_uuid"`
+        Filename       string          `json:"filename" db:"filename"`
+        Content        string          `json:"content" db:"content"`
+        FileAnalysis   json.RawMessage `json:"file_analysis" db:"file_analysis"`
+        AnalysisStatus string          `json:"analysis_status" db:"analysis_status"`
+        AnalysisError  *string         `json:"analysis_error" db:"analysis_error"`
+        CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+}
+
+// FileAnalysisStatus is the progress of the background analysis of an uploaded file
+type FileAnalysisStatus struct {
+        FileID         int     `json:"file_id"`
+        Filename       string  `json:"filename"`
+        AnalysisStatus string  `json:"analysis_status"`
+        AnalysisError  *string `json:"analysis_error,omitempty"`
+}
+
+// File analysis statuses
+const (
+        FileAnalysisQueued    = "queued"
+        FileAnalysisAnalyzing = "analyzing"
+        FileAnalysisDone      = "done"
+        FileAnalysisFailed    = "failed"
+)
+
+type FileIssue struct {
+        ID             int       `json:"id" db:"id"`
+        ProjectUUID    uuid.UUID `json:"project_uuid" db:"project_uuid"`
+        FileID         int       `json:"file_id" db:"file_id"`
+        Filename       string    `json:"filename" db:"filename"`
+        Name           string    `json:"name" db:"name"`
+        Description    string    `json:"description" db:"description"`
+        Recommendation string    `json:"recommendation" db:"recommendation"`
+        LineStart      *int      `json:"line_start" db:"line_start"`
+        LineEnd        *int      `json:"line_end" db:"line_end"`
+        ColumnStart    *int      `json:"column_start" db:"column_start"`
+        ColumnEnd      *int      `json:"column_end" db:"column_end"`
+        Severity       string    `json:"severity" db:"severity"`
+        State          string    `json:"state" db:"state"`
+        CreatedAt      time.Time `json:"created_at" db:"created_at"`
+        UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// File issue states: a suspicion is a doubtful finding, a confirmed issue is a real problem
+const (
+        IssueStateSuspicion = "suspicion"
+        IssueStateConfirmed = "confirmed"
+)
+
+// FileIssueChange records a state change of a file issue and the reason behind it
+type FileIssueChange struct {
+        ID                 int       `json:"id" db:"id"`
+        IssueID            int       `json:"issue_id" db:"issue_id"`
+        ProjectUUID        uuid.UUID `json:"project_uuid" db:"project_uuid"`
+        OldState           string    `json:"old_state" db:"old_state"`
+        NewState           string    `json:"new_state" db:"new_state"`
+        Reason             string    `json:"reason" db:"reason"`
+        SupportingIssueIDs []int     `json:"supporting_issue_ids" db:"supporting_issue_ids"`
+        CreatedAt          time.Time `json:"created_at" db:"created_at"`
+}
+
+// ResultLink connects an anomaly in the load test results to the file issue that likely causes it
+type ResultLink struct {
+        Metric        string `json:"metric"`
+        Endpoint      string `json:"endpoint"`
+        ObservedValue string `json:"observed_value"`
+        FileIssueID   int    `json:"file_issue_id"`
+        IssueName     string `json:"issue_name"`
+        Filename      string `json:"filename"`
+        LineStart     *int   `json:"line_start"`
+        Explanation   string `json:"explanation"`
+}
+
+// FileIssueFilter selects file issues by severity and state; empty slices match everything
+type FileIssueFilter struct {
+        Severities []string
+        States     []string
 }
 
 type TestResults struct {
@@ -41,9 +179,354 @@ type TestResults struct {
         FailedCalls               int             `json:"failed_calls" db:"failed_calls"`
         NonfunctionalRequirements json.RawMessage `json:"nonfunctional_requirements" db:"nonfunctional_requirements"`
         RawResults                json.RawMessage `json:"raw_results" db:"raw_results"`
+        TestDurationSeconds       *float64        `json:"test_duration_seconds" db:"test_duration_seconds"`
+        AchievedRPS               *float64        `json:"achieved_rps" db:"achieved_rps"`
+        Stages                    json.RawMessage `json:"stages" db:"stages"`
         CreatedAt                 time.Time       `json:"created_at" db:"created_at"`
 }
 
+// EndpointMetrics holds the response time distribution (in milliseconds), throughput
+// and error counts of a single endpoint. PercentilesSource tells whether the percentiles
+// were reported by the testing tool or computed by the service from raw samples.
+type EndpointMetrics struct {
+        ID                int               `json:"id,omitempty" db:"id"`
+        TestResultID      int               `json:"test_result_id,omitempty" db:"test_result_id"`
+        Name              string            `json:"name" db:"name"`
+        Method            string            `json:"method" db:"method"`
+        P50               *float64          `json:"p50" db:"p50"`
+        P90               *float64          `json:"p90" db:"p90"`
+        P95               *float64          `json:"p95" db:"p95"`
+        P99               *float64          `json:"p99" db:"p99"`
+        Max               *float64          `json:"max" db:"max"`
+        RPS               *float64          `json:"rps" db:"rps"`
+        Requests          int               `json:"requests" db:"requests"`
+        Errors            int               `json:"errors" db:"errors"`
+        ErrorCounts       map[string]int    `json:"error_counts,omitempty" db:"error_counts"`
+        PercentilesSource string            `json:"percentiles_source,omitempty" db:"percentiles_source"`
+        Histogram         *LatencyHistogram `json:"-" db:"latency_histogram"`
+}
+
+// Sources of endpoint percentiles
+const (
+        PercentilesReported = "reported"
+        PercentilesComputed = "computed"
+)
+
+// LatencyHistogram is a serialized HDR histogram of response times in microseconds.
+// Buckets hold [lowest equivalent value, count] pairs of the non-empty buckets.
+type LatencyHistogram struct {
+        SignificantDigits int        `json:"significant_digits"`
+        TotalCount        int64      `json:"total_count"`
+        MinMicros         int64      `json:"min_us"`
+        MaxMicros         int64      `json:"max_us"`
+        Buckets           [][2]int64 `json:"buckets"`
+}
+
+// NFRRule is a machine-checkable nonfunctional requirement, e.g. "p95 < 300ms for GET /items"
+type NFRRule struct {
+        Requirement string  `json:"requirement"`
+        Metric      string  `json:"metric"`
+        Operator    string  `json:"operator"`
+        Threshold   float64 `json:"threshold"`
+        Unit        string  `json:"unit"`
+        Endpoint    string  `json:"endpoint,omitempty"`
+}
+
+// NFRResult is the outcome of checking a nonfunctional requirement against the submitted metrics
+type NFRResult struct {
+        Requirement string   `json:"requirement"`
+        Metric      string   `json:"metric"`
+        Endpoint    string   `json:"endpoint,omitempty"`
+        Operator    string   `json:"operator"`
+        Threshold   float64  `json:"threshold"`
+        Actual      *float64 `json:"actual"`
+        Unit        string   `json:"unit"`
+        Status      string   `json:"status"`
+        Detail      string   `json:"detail"`
+}
+
+// NFR evaluation statuses
+const (
+        NFRPass    = "pass"
+        NFRFail    = "fail"
+        NFRUnknown = "unknown"
+)
+
+// StageResult is the actual outcome of a ramp stage reported with the test results
+type StageResult struct {
+        Name        string  `json:"name"`
+        Completed   bool    `json:"completed"`
+        AchievedRPS float64 `json:"achieved_rps"`
+        AchievedVUs int     `json:"achieved_vus"`
+}
+
+// MetricInterval is one time bucket of the test: achieved throughput, active virtual users,
+// response time percentiles (in milliseconds) and errors within the bucket
+type MetricInterval struct {
+        ID              int       `json:"id,omitempty" db:"id"`
+        TestResultID    int       `json:"test_result_id,omitempty" db:"test_result_id"`
+        Start           time.Time `json:"start" db:"start_time"`
+        DurationSeconds float64   `json:"duration_seconds" db:"duration_seconds"`
+        RPS             *float64  `json:"rps" db:"rps"`
+        ActiveVUs       *int      `json:"active_vus" db:"active_vus"`
+        P50             *float64  `json:"p50" db:"p50"`
+        P90             *float64  `json:"p90" db:"p90"`
+        P95             *float64  `json:"p95" db:"p95"`
+        P99             *float64  `json:"p99" db:"p99"`
+        Requests        int       `json:"requests" db:"requests"`
+        Errors          int       `json:"errors" db:"errors"`
+}
+
+// LoadProfileConformance compares the achieved load curve with the profile declared in project_info
+type LoadProfileConformance struct {
+        Evaluated  bool                 `json:"evaluated"`
+        Conforms   bool                 `json:"conforms"`
+        Detail     string               `json:"detail"`
+        Stages     []StageConformance   `json:"stages"`
+        Findings   []LoadProfileFinding `json:"findings"`
+        Saturation *SaturationPoint     `json:"saturation,omitempty"`
+}
+
+// StageConformance is what the intervals show for one declared stage
+type StageConformance struct {
+        Name               string   `json:"name"`
+        StartOffsetSeconds float64  `json:"start_offset_seconds"`
+        DurationSeconds    float64  `json:"duration_seconds"`
+        TargetRPS          float64  `json:"target_rps,omitempty"`
+        TargetVUs          int      `json:"target_vus,omitempty"`
+        Intervals          int      `json:"intervals"`
+        PeakRPS            *float64 `json:"peak_rps"`
+        MeanRPS            *float64 `json:"mean_rps"`
+        PeakVUs            *int     `json:"peak_vus"`
+        P95Start           *float64 `json:"p95_start"`
+        P95End             *float64 `json:"p95_end"`
+        ErrorRatePercent   *float64 `json:"error_rate_percent"`
+        Status             string   `json:"status"`
+}
+
+// LoadProfileFinding is a divergence between the planned and the achieved load
+type LoadProfileFinding struct {
+        Type   string `json:"type"`
+        Stage  string `json:"stage,omitempty"`
+        Detail string `json:"detail"`
+}
+
+// SaturationPoint is the load level where adding virtual users stopped adding throughput
+type SaturationPoint struct {
+        VUs    int     `json:"vus"`
+        RPS    float64 `json:"rps"`
+        Stage  string  `json:"stage,omitempty"`
+        Detail string  `json:"detail"`
+}
+
+// Load profile finding types
+const (
+        FindingStageNotRun         = "stage_not_run"
+        FindingTargetRPSNotReached = "target_rps_not_reached"
+        FindingTargetVUsNotReached = "target_vus_not_reached"
+        FindingLatencyDegradation  = "latency_degradation"
+        FindingSaturation          = "saturation"
+)
+
+// CapacityEstimate is the throughput a stepped load test reached before latency started growing
+// non-linearly or errors spiked
+type CapacityEstimate struct {
+        Evaluated bool       `json:"evaluated"`
+        Detected  bool       `json:"detected"`
+        Reason    string     `json:"reason,omitempty"`
+        LimitRPS  *float64   `json:"limit_rps"`
+        LimitVUs  *int       `json:"limit_vus"`
+        LimitP95  *float64   `json:"limit_p95"`
+        Stage     string     `json:"stage,omitempty"`
+        KneeStage string     `json:"knee_stage,omitempty"`
+        Detail    string     `json:"detail"`
+        Steps     []LoadStep `json:"steps"`
+}
+
+// LoadStep is one load level of a stepped test as measured by its intervals
+type LoadStep struct {
+        Name             string   `json:"name"`
+        Intervals        int      `json:"intervals"`
+        RPS              *float64 `json:"rps"`
+        VUs              *int     `json:"vus"`
+        P95              *float64 `json:"p95"`
+        ErrorRatePercent *float64 `json:"error_rate_percent"`
+}
+
+// Reasons a capacity limit was detected
+const (
+        CapacityLatencyKnee       = "latency_knee"
+        CapacityErrorSpike        = "error_spike"
+        CapacityThroughputPlateau = "throughput_plateau"
+)
+
+// Baseline is the run of a tenant/repo that new runs are compared against
+type Baseline struct {
+        ID           int                  `json:"id" db:"id"`
+        Tenant       string               `json:"tenant" db:"tenant"`
+        Repo         string               `json:"repo" db:"repo"`
+        ProjectUUID  uuid.UUID            `json:"project_uuid" db:"project_uuid"`
+        TestResultID int                  `json:"test_result_id" db:"test_result_id"`
+        Tolerances   RegressionTolerances `json:"tolerances" db:"tolerances"`
+        CreatedAt    time.Time            `json:"created_at" db:"created_at"`
+}
+
+// RegressionTolerances are the changes against the baseline that still count as no regression
+type RegressionTolerances struct {
+        LatencyPercent    float64 `json:"latency_percent"`
+        ErrorRatePoints   float64 `json:"error_rate_points"`
+        ThroughputPercent float64 `json:"throughput_percent"`
+        SignificanceLevel float64 `json:"significance_level"`
+}
+
+// BaselineComparison is the outcome of comparing a run with the baseline of its tenant/repo
+type BaselineComparison struct {
+        Evaluated         bool                 `json:"evaluated"`
+        Regressed         bool                 `json:"regressed"`
+        BaselineUUID      *uuid.UUID           `json:"baseline_uuid,omitempty"`
+        BaselineSetAt     *time.Time           `json:"baseline_set_at,omitempty"`
+        Tolerances        RegressionTolerances `json:"tolerances"`
+        Detail            string               `json:"detail"`
+        Metrics           []MetricComparison   `json:"metrics"`
+        RegressionsCount  int                  `json:"regressions_count"`
+        ImprovementsCount int                  `json:"improvements_count"`
+}
+
+// MetricComparison compares one metric of the run with the baseline. Change is relative, in
+// percent, for latency and throughput and absolute, in percentage points, for the error rate.
+// Latency metrics of endpoints with raw samples on both sides also carry a two-sample
+// Kolmogorov-Smirnov test.
+type MetricComparison struct {
+        Endpoint    string   `json:"endpoint"`
+        Metric      string   `json:"metric"`
+        Baseline    *float64 `json:"baseline"`
+        Current     *float64 `json:"current"`
+        Change      *float64 `json:"change"`
+        Unit        string   `json:"unit"`
+        KSStatistic *float64 `json:"ks_statistic,omitempty"`
+        PValue      *float64 `json:"p_value,omitempty"`
+        Significant *bool    `json:"significant,omitempty"`
+        Status      string   `json:"status"`
+        Detail      string   `json:"detail"`
+}
+
+// Metric comparison statuses
+const (
+        ComparisonRegression  = "regression"
+        ComparisonImprovement = "improvement"
+        ComparisonUnchanged   = "unchanged"
+        ComparisonMissing     = "missing"
+)
+
+// RunComparison is a side-by-side diff of two analysed runs: A is the earlier one, B the later
+type RunComparison struct {
+        UUIDA             uuid.UUID          `json:"uuid_a"`
+        UUIDB             uuid.UUID          `json:"uuid_b"`
+        SameRepo          bool               `json:"same_repo"`
+        Metrics           BaselineComparison `json:"metrics"`
+        NFRChanges        []NFRChange        `json:"nfr_changes"`
+        IssuesAppeared    []FileIssue        `json:"issues_appeared"`
+        IssuesDisappeared []FileIssue        `json:"issues_disappeared"`
+        IssuesPersisted   int                `json:"issues_persisted"`
+        Scores            []ScoreChange      `json:"scores"`
+        Narrative         *string            `json:"narrative,omitempty"`
+}
+
+// NFRChange is the outcome of one nonfunctional requirement in both runs
+type NFRChange struct {
+        Requirement string   `json:"requirement"`
+        StatusA     string   `json:"status_a"`
+        StatusB     string   `json:"status_b"`
+        ActualA     *float64 `json:"actual_a"`
+        ActualB     *float64 `json:"actual_b"`
+        Unit        string   `json:"unit"`
+        Changed     bool     `json:"changed"`
+}
+
+// ScoreChange is an AI score of the final analysis in both runs
+type ScoreChange struct {
+        Name  string   `json:"name"`
+        A     *float64 `json:"a"`
+        B     *float64 `json:"b"`
+        Delta *float64 `json:"delta"`
+}
+
+// RepoTrend is the history of the runs of a tenant/repo, oldest first
+type RepoTrend struct {
+        Tenant  string        `json:"tenant"`
+        Repo    string        `json:"repo"`
+        From    *time.Time    `json:"from"`
+        To      *time.Time    `json:"to"`
+        Points  []TrendPoint  `json:"points"`
+        Changes []TrendChange `json:"changes"`
+}
+
+// TrendPoint is one run of the repo
+type TrendPoint struct {
+        ProjectUUID      uuid.UUID       `json:"uuid"`
+        CreatedAt        time.Time       `json:"created_at"`
+        Status           string          `json:"status"`
+        OverallScore     *float64        `json:"overall_score"`
+        ErrorRatePercent *float64        `json:"error_rate_percent"`
+        AchievedRPS      *float64        `json:"achieved_rps"`
+        OpenIssues       int             `json:"open_issues"`
+        ConfirmedIssues  int             `json:"confirmed_issues"`
+        Endpoints        []TrendEndpoint `json:"endpoints"`
+}
+
+// TrendEndpoint is the tail latency of an endpoint in one run
+type TrendEndpoint struct {
+        Endpoint string   `json:"endpoint"`
+        P95      *float64 `json:"p95"`
+        P99      *float64 `json:"p99"`
+}
+
+// TrendChange is how a metric moved from the first to the last run that reported it
+type TrendChange struct {
+        Metric    string   `json:"metric"`
+        Endpoint  string   `json:"endpoint,omitempty"`
+        First     *float64 `json:"first"`
+        Last      *float64 `json:"last"`
+        Runs      int      `json:"runs"`
+        Direction string   `json:"direction"`
+}
+
+// Trend directions
+const (
+        TrendImproving = "improving"
+        TrendDegrading = "degrading"
+        TrendStable    = "stable"
+)
+
+// TestValidity is the verdict on whether the load test was conducted correctly
+type TestValidity struct {
+        Valid         bool            `json:"valid"`
+        Confidence    string          `json:"confidence"`
+        Reasons       []string        `json:"reasons"`
+        Checks        []ValidityCheck `json:"checks"`
+        AIExplanation string          `json:"ai_explanation"`
+}
+
+// ValidityCheck is a single deterministic check comparing the planned and the actual test
+type ValidityCheck struct {
+        Name     string `json:"name"`
+        Status   string `json:"status"`
+        Expected string `json:"expected"`
+        Actual   string `json:"actual"`
+        Detail   string `json:"detail"`
+}
+
+// Validity check statuses and verdict confidence levels
+const (
+        CheckPassed  = "passed"
+        CheckFailed  = "failed"
+        CheckSkipped = "skipped"
+
+        ConfidenceLow    = "low"
+        ConfidenceMedium = "medium"
+        ConfidenceHigh   = "high"
+)
+
 type AnalysisResult struct {
         ID            int             `json:"id" db:"id"`
         ProjectUUID   uuid.UUID       `json:"project_uuid" db:"project_uuid"`
@@ -54,6 +537,81 @@ type AnalysisResult struct {
         CompletedAt   *time.Time      `json:"completed_at" db:"completed_at"`
 }
 
+// Job is a unit of background work in the durable job queue
+type Job struct {
+        ID             int64      `json:"id" db:"id"`
+        Kind           string     `json:"kind" db:"kind"`
+        ProjectUUID    uuid.UUID  `json:"project_uuid" db:"project_uuid"`
+        FileID         *int       `json:"file_id" db:"file_id"`
+        Status         string     `json:"status" db:"status"`
+        Attempts       int        `json:"attempts" db:"attempts"`
+        MaxAttempts    int        `json:"max_attempts" db:"max_attempts"`
+        NextRunAt      time.Time  `json:"next_run_at" db:"next_run_at"`
+        LockedBy       *string    `json:"locked_by" db:"locked_by"`
+        LeaseExpiresAt *time.Time `json:"lease_expires_at" db:"lease_expires_at"`
+        HeartbeatAt    *time.Time `json:"heartbeat_at" db:"heartbeat_at"`
+        LastError      *string    `json:"last_error" db:"last_error"`
+        CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+        UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Job kinds and statuses
+const (
+        JobKindFinalAnalysis = "final_analysis"
+        JobKindInputReview   = "input_review"
+        JobKindFileAnalysis  = "file_analysis"
+
+        JobQueued  = "queued"
+        JobRunning = "running"
+        JobDone    = "done"
+        JobFailed  = "failed"
+)
+
+// AnalysisAttempt is a failed attempt of a final analysis stage kept in the attempts log
+type AnalysisAttempt struct {
+        ID           int       `json:"id" db:"id"`
+        ProjectUUID  uuid.UUID `json:"project_uuid" db:"project_uuid"`
+        Stage        string    `json:"stage" db:"stage"`
+        Attempt      int       `json:"attempt" db:"attempt"`
+        ErrorMessage string    `json:"error_message" db:"error_message"`
+        Transient    bool      `json:"transient" db:"transient"`
+        CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// Stages of the final analysis, each retried on its own
+const (
+        AnalysisStagePrepare = "prepare"
+        AnalysisStageAI      = "ai_analysis"
+        AnalysisStageSave    = "save_results"
+        AnalysisStageFile    = "file_analysis"
+)
+
+type InputReview struct {
+        ID           int             `json:"id" db:"id"`
+        ProjectUUID  uuid.UUID       `json:"project_uuid" db:"project_uuid"`
+        Issues       json.RawMessage `json:"issues" db:"issues"`
+        Status       string          `json:"status" db:"status"`
+        ErrorMessage *string         `json:"error_message" db:"error_message"`
+        CreatedAt    time.Time       `json:"created_at" db:"created_at"`
+        CompletedAt  *time.Time      `json:"completed_at" db:"completed_at"`
+}
+
+// InputIssue is a problem the AI model found in the submitted test input parameters
+type InputIssue struct {
+        Name           string `json:"name"`
+        Description    string `json:"description"`
+        Recommendation string `json:"recommendation"`
+        Severity       string `json:"severity"`
+}
+
+// Issue severity levels
+const (
+        SeverityLow      = "low"
+        SeverityMedium   = "medium"
+        SeverityHigh     = "high"
+        SeverityCritical = "critical"
+)
+
 // Request/Response models
 type InitAnalyzeRequest struct {
         Language    string          `json:"language"`
@@ -62,6 +620,11 @@ type InitAnalyzeRequest struct {
         FilesCount  int             `json:"files_count"`
 }
 
+// SetBaselineRequest optionally overrides the default regression tolerances
+type SetBaselineRequest struct {
+        Tolerances *RegressionTolerances `json:"tolerances"`
+}
+
 type SendFileRequest struct {
         Filename string `json:"filename"`
         Content  string `json:"content"`
@@ -74,6 +637,11 @@ type SendResultsRequest struct {
         FailedCalls               int             `json:"failed_calls"`
         NonfunctionalRequirements json.RawMessage `json:"nonfunctional_requirements"`
         RawResults                json.RawMessage `json:"raw_results"`
+        TestDuration              json.RawMessage   `json:"test_duration"`
+        AchievedRPS               *float64          `json:"achieved_rps"`
+        Stages                    []StageResult     `json:"stages"`
+        Endpoints                 []EndpointMetrics `json:"endpoints"`
+        Intervals                 []MetricInterval  `json:"intervals"`
 }
 
 // AI Model API structures
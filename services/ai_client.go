@@ -1,12 +1,16 @@
 package services
 
 import (
+        "context"
         "encoding/json"
+        "errors"
         "fmt"
         "log"
+        "net"
         "net/http"
         "strings"
 
+        "github.com/jackc/pgx/v5/pgxpool"
         "github.com/performance-analyzer/models"
         "github.com/performance-analyzer/utils"
 )
@@ -14,20 +18,44 @@ import (
 type AIClient struct {
         baseURL    string
         httpClient *utils.LoggedHTTPClient
+        // slots caps the requests in flight from this instance, so waiting requests do not
+        // take every pooled connection; every Query holds one
+        slots chan struct{}
+        // sharedSlots caps the requests in flight from all instances together
+        sharedSlots *aiSlots
 }
 
-func NewAIClient(baseURL string) *AIClient {
+// NewAIClient creates the client of the AI model. At most maxConcurrency requests are in
+// flight at once across every instance sharing db.
+func NewAIClient(baseURL string, maxConcurrency int, db *pgxpool.Pool) *AIClient {
         if baseURL == "" {
                 baseURL = "http://localhost:1234"
         }
+        if maxConcurrency < 1 {
+                maxConcurrency = 1
+        }
 
         return &AIClient{
-                baseURL:    baseURL,
-                httpClient: utils.NewLoggedHTTPClient(),
+                baseURL:     baseURL,
+                httpClient:  utils.NewLoggedHTTPClient(),
+                slots:       make(chan struct{}, maxConcurrency),
+                sharedSlots: &aiSlots{db: db, size: maxConcurrency},
         }
 }
 
-func (c *AIClient) Query(query string) (*models.AIModelResponse, error) {
+func (c *AIClient) Query(ctx context.Context, query string) (*models.AIModelResponse, error) {
+        select {
+        case c.slots <- struct{}{}:
+                defer func() { <-c.slots }()
+        case <-ctx.Done():
+                return nil, ctx.Err()
+        }
+        release, err := c.sharedSlots.acquire(ctx)
+        if err != nil {
+                return nil, err
+        }
+        defer release()
+
         // Escape the query text for JSON
         escapedQuery := strings.ReplaceAll(query, `"`, `\"`)
         escapedQuery = strings.ReplaceAll(escapedQuery, "\n", "\\n")
@@ -48,13 +76,23 @@ func (c *AIClient) Query(query string) (*models.AIModelResponse, error) {
         url := c.baseURL + "/api/v1/query"
         log.Printf("Making AI service request to: %s", url)
         
-        resp, err := c.httpClient.Post(url, requestBody)
+        resp, err := c.httpClient.Post(ctx, url, requestBody)
         if err != nil {
-                // Return mock response when AI service is unavailable
-                return c.getMockResponse(query), nil
+                // Return mock response when AI service is not deployed; a timeout or a dropped
+                // connection of a running service is returned so the analysis is retried
+                var opErr *net.OpError
+                if errors.As(err, &opErr) && opErr.Op == "dial" {
+                        return c.getMockResponse(query), nil
+                }
+                return nil, fmt.Errorf("AI service request failed: %w", err)
         }
         defer resp.Body.Close()
 
+        // An overloaded or failing AI service is worth retrying
+        if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+                return nil, transient(fmt.Errorf("AI service returned status %d", resp.StatusCode))
+        }
+
         // Check for HTTP errors
         if resp.StatusCode != http.StatusOK {
                 log.Printf("AI service returned status %d, using mock response", resp.StatusCode)
@@ -77,11 +115,11 @@ func (c *AIClient) Query(query string) (*models.AIModelResponse, error) {
 }
 
 // HealthCheck checks if the AI service is available
-func (c *AIClient) HealthCheck() error {
+func (c *AIClient) HealthCheck(ctx context.Context) error {
         url := c.baseURL + "/health"
         log.Printf("Performing AI service health check: %s", url)
         
-        resp, err := c.httpClient.Get(url)
+        resp, err := c.httpClient.Get(ctx, url)
         if err != nil {
                 return fmt.Errorf("health check request failed: %w", err)
         }
@@ -94,39 +132,71 @@ func (c *AIClient) HealthCheck() error {
         return nil
 }
 
+// parseJSONContent extracts the JSON object from the model's content field.
+// Models often wrap JSON in markdown code fences or add a sentence around it,
+// so everything outside the outermost braces is ignored.
+func parseJSONContent(content string, v interface{}) error {
+        start := strings.Index(content, "{")
+        end := strings.LastIndex(content, "}")
+        if start == -1 || end < start {
+                return fmt.Errorf("no JSON object found in AI response")
+        }
+
+        if err := json.Unmarshal([]byte(content[start:end+1]), v); err != nil {
+                return fmt.Errorf("failed to parse AI response JSON: %w", err)
+        }
+        return nil
+}
+
 // getMockResponse returns a mock AI response for testing purposes
 func (c *AIClient) getMockResponse(query string) *models.AIModelResponse {
         var content string
         
-        if strings.Contains(query, "файл кода") || strings.Contains(query, "file") {
-                // File analysis response
+        if strings.Contains(query, "входные параметры нагрузочного теста") {
+                // Input parameters review response
                 content = `{
-                        "issues": ["Потенциальные проблемы не обнаружены в данном коде"],
-                        "recommendations": ["Добавить обработку ошибок", "Рассмотреть возможность логирования"],
-                        "performance_score": 8,
-                        "analysis_type": "file_analysis",
+                        "issues": [
+                                {
+                                        "name": "Не указан профиль нагрузки",
+                                        "description": "Во входных параметрах отсутствует описание ступеней и длительности подачи нагрузки",
+                                        "recommendation": "Описать ступени нагрузки, их длительность и целевой RPS на каждой ступени",
+                                        "severity": "medium"
+                                }
+                        ],
                         "note": "Демонстрационный анализ - AI модель недоступна"
                 }`
-        } else {
-                // Final analysis response
+        } else if strings.Contains(query, "подтверждение подозрений") {
+                // Cross-file correlation response
                 content = `{
-                        "summary": "Анализ производительности завершен. Проект показывает хорошие результаты с 95% успешными вызовами.",
-                        "performance_assessment": 7,
-                        "identified_issues": [
-                                "5% неуспешных вызовов указывает на потенциальные проблемы",
-                                "Время ответа P99 превышает рекомендуемые значения"
-                        ],
-                        "recommendations": [
-                                "Исследовать причины неуспешных вызовов",
-                                "Оптимизировать медленные запросы",
-                                "Добавить кэширование для часто используемых данных"
+                        "decisions": [],
+                        "note": "Демонстрационный анализ - AI модель недоступна"
+                }`
+        } else if strings.Contains(query, "Сравните два прогона нагрузочного теста") {
+                // Comparison narrative response, plain text
+                content = "Демонстрационное сравнение - AI модель недоступна. Изменения метрик, требований и проблем в файлах приведены в сравнении."
+        } else if strings.Contains(query, "результаты тестирования производительности") {
+                // Final analysis response; checked before files, as the prompt lists the files and their issues
+                content = finalAnalysisMock
+        } else if strings.Contains(query, "следующий файл кода") {
+                // File analysis response
+                content = `{
+                        "summary": "Серьезных проблем производительности в данном коде не обнаружено",
+                        "issues": [
+                                {
+                                        "name": "Отсутствует обработка ошибок",
+                                        "description": "Ошибки внешних вызовов не обрабатываются, что может привести к каскадным сбоям под нагрузкой",
+                                        "recommendation": "Добавить обработку ошибок и логирование",
+                                        "location": {"line_start": 1, "line_end": 1, "column_start": 1, "column_end": 1},
+                                        "severity": "low",
+                                        "doubtful": true
+                                }
                         ],
-                        "detailed_analysis": "Система показывает стабильную работу с 9500 успешными из 10000 запросов. Время ответа P95 находится в пределах нормы, но P99 требует внимания.",
-                        "code_quality_score": 8,
-                        "load_test_score": 7,
-                        "overall_score": 7,
+                        "performance_score": 8,
+                        "analysis_type": "file_analysis",
                         "note": "Демонстрационный анализ - AI модель недоступна"
                 }`
+        } else {
+                content = finalAnalysisMock
         }
         
         return &models.AIModelResponse{
@@ -134,3 +204,25 @@ func (c *AIClient) getMockResponse(query string) *models.AIModelResponse {
                 Chunks:  []models.AIChunk{},
         }
 }
+
+// finalAnalysisMock is the final analysis returned when the AI service is not deployed
+const finalAnalysisMock = `{
+        "summary": "Анализ производительности завершен. Проект показывает хорошие результаты с 95% успешными вызовами.",
+        "performance_assessment": 7,
+        "identified_issues": [
+                "5% неуспешных вызовов указывает на потенциальные проблемы",
+                "Время ответа P99 превышает рекомендуемые значения"
+        ],
+        "recommendations": [
+                "Исследовать причины неуспешных вызовов",
+                "Оптимизировать медленные запросы",
+                "Добавить кэширование для часто используемых данных"
+        ],
+        "detailed_analysis": "Система показывает стабильную работу с 9500 успешными из 10000 запросов. Время ответа P95 находится в пределах нормы, но P99 требует внимания.",
+        "code_quality_score": 8,
+        "load_test_score": 7,
+        "overall_score": 7,
+        "result_links": [],
+        "test_validity_explanation": "Корректность теста оценена по результатам детерминированной проверки входных данных и фактической нагрузки",
+        "note": "Демонстрационный анализ - AI модель недоступна"
+}`
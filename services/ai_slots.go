@@ -0,0 +1,66 @@
+package services
+
+import (
+        "context"
+        "fmt"
+        "log"
+        "time"
+
+        "github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+        // aiSlotsLockClass is the advisory lock namespace of the AI request slots; slot n is
+        // the lock (aiSlotsLockClass, n)
+        aiSlotsLockClass = 41901
+        // aiSlotPollInterval is how often a request waiting for a free slot tries again
+        aiSlotPollInterval = 500 * time.Millisecond
+)
+
+// aiSlots caps the requests in flight to the AI model across every instance sharing the
+// database. A slot is a session advisory lock held on a pooled connection for the length
+// of the request, so the slots of a crashed instance are freed with its connections.
+type aiSlots struct {
+        db   *pgxpool.Pool
+        size int
+}
+
+// acquire waits for a free slot and returns the function that frees it
+func (s *aiSlots) acquire(ctx context.Context) (func(), error) {
+        conn, err := s.db.Acquire(ctx)
+        if err != nil {
+                return nil, fmt.Errorf("failed to acquire AI request slot: %w", err)
+        }
+
+        for {
+                for slot := 0; slot < s.size; slot++ {
+                        var locked bool
+                        err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1, $2)", aiSlotsLockClass, slot).Scan(&locked)
+                        if err != nil {
+                                conn.Release()
+                                return nil, fmt.Errorf("failed to acquire AI request slot: %w", err)
+                        }
+                        if locked {
+                                return func() { s.release(conn, slot) }, nil
+                        }
+                }
+
+                select {
+                case <-time.After(aiSlotPollInterval):
+                case <-ctx.Done():
+                        conn.Release()
+                        return nil, ctx.Err()
+                }
+        }
+}
+
+// release frees the slot and hands the connection back to the pool. A connection whose
+// lock could not be released is closed instead, which frees the lock with the session.
+func (s *aiSlots) release(conn *pgxpool.Conn, slot int) {
+        ctx := context.Background()
+        if _, err := conn.Exec(ctx, "SELECT pg_advisory_unlock($1, $2)", aiSlotsLockClass, slot); err != nil {
+                log.Printf("Failed to release AI request slot %d, closing its connection: %v", slot, err)
+                conn.Conn().Close(ctx)
+        }
+        conn.Release()
+}
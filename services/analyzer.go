@@ -3,9 +3,12 @@ package services
 import (
         "context"
         "encoding/json"
+        "errors"
         "fmt"
         "log"
+        "strconv"
         "strings"
+        "sync"
         "time"
 
         "github.com/google/uuid"
@@ -16,125 +19,276 @@ import (
 type Analyzer struct {
         db       *pgxpool.Pool
         aiClient *AIClient
-        queue    chan uuid.UUID
+        jobs     *JobQueue
+        // stopping is closed by Shutdown so the workers stop claiming jobs
+        stopping chan struct{}
+        // cancelJobs cancels the running jobs when the shutdown deadline passes
+        cancelJobs context.CancelFunc
+        workers    sync.WaitGroup
 }
 
 func NewAnalyzer(db *pgxpool.Pool, aiClient *AIClient) *Analyzer {
         return &Analyzer{
                 db:       db,
                 aiClient: aiClient,
-                queue:    make(chan uuid.UUID, 100), // Buffer for 100 analysis requests
+                jobs:     NewJobQueue(db),
+                stopping: make(chan struct{}),
         }
 }
 
-func (a *Analyzer) StartBackgroundProcessor() {
-        log.Println("Starting background analyzer processor...")
-        for projectUUID := range a.queue {
-                log.Printf("Processing analysis for project %s", projectUUID)
-                a.processAnalysis(projectUUID)
+// TriggerFinalAnalysis queues the final analysis of the project in the job queue
+func (a *Analyzer) TriggerFinalAnalysis(ctx context.Context, projectUUID uuid.UUID) error {
+        if err := a.jobs.Enqueue(ctx, models.JobKindFinalAnalysis, projectUUID); err != nil {
+                return err
         }
+        log.Printf("Queued analysis for project %s", projectUUID)
+        return nil
 }
 
-func (a *Analyzer) TriggerFinalAnalysis(projectUUID uuid.UUID) {
-        select {
-        case a.queue <- projectUUID:
-                log.Printf("Queued analysis for project %s", projectUUID)
-        default:
-                log.Printf("Analysis queue is full, skipping project %s", projectUUID)
-        }
-}
-
-func (a *Analyzer) AnalyzeFile(content string) (json.RawMessage, error) {
+// AnalyzeFile asks the AI model to review a code file of the project against its test
+// configuration and returns the analysis document together with the issues parsed from the model's JSON
+func (a *Analyzer) AnalyzeFile(ctx context.Context, project *models.Project, filename, content string) (json.RawMessage, []models.FileIssue, error) {
         prompt := fmt.Sprintf(`Проанализируйте следующий файл кода как эксперт по тестированию производительности. 
-Укажите потенциальные проблемы производительности, узкие места, и рекомендации по оптимизации.
-Ответьте в формате JSON с полями: issues (проблемы), recommendations (рекомендации), performance_score (оценка от 1 до 10).
+Оцените код с учетом параметров нагрузочного теста: ожидаемой нагрузки, стенда, профиля нагрузки и нефункциональных требований.
+Укажите проблемы и подозрения на проблемы производительности, узкие места, и рекомендации по оптимизации.
+Ответьте в формате JSON с полями:
+- summary: краткое резюме по файлу
+- performance_score: оценка от 1 до 10
+- issues: массив проблем, у каждой проблемы поля name (название), description (объяснение), recommendation (рекомендации по устранению),
+  location (место в коде: line_start, line_end, column_start, column_end), severity (критичность: low, medium, high, critical)
+  и doubtful (сомнительность: true - подозрение, которое требует подтверждения, false - подтвержденная проблема)
+
+Язык проекта: %s
+Инструмент тестирования: %s
+Параметры тестирования:
+%s
 
+Файл: %s
 Код файла:
-%s`, content)
+%s`, project.Language, project.TestingTool, string(project.ProjectInfo), filename, content)
 
-        response, err := a.aiClient.Query(prompt)
+        response, err := a.aiClient.Query(ctx, prompt)
         if err != nil {
-                return nil, fmt.Errorf("AI analysis failed: %w", err)
+                return nil, nil, fmt.Errorf("AI analysis failed: %w", err)
         }
 
         // Parse and structure the response
         analysisResult := map[string]interface{}{
                 "ai_response":  response.Content,
                 "analyzed_at":  time.Now(),
+                "filename":     filename,
                 "file_size":    len(content),
                 "analysis_type": "file_analysis",
         }
 
+        issues, err := parseFileIssues(response.Content)
+        if err != nil {
+                log.Printf("Failed to parse file issues from AI response: %v", err)
+                analysisResult["parse_error"] = err.Error()
+        }
+        analysisResult["issues_count"] = len(issues)
+
         resultJSON, err := json.Marshal(analysisResult)
         if err != nil {
-                return nil, fmt.Errorf("failed to marshal analysis result: %w", err)
+                return nil, nil, fmt.Errorf("failed to marshal analysis result: %w", err)
+        }
+
+        return json.RawMessage(resultJSON), issues, nil
+}
+
+// processAnalysis runs the final analysis stage by stage; each stage is retried on its own,
+// so an AI timeout does not reload the inputs and a failed save does not repeat the AI call
+func (a *Analyzer) processAnalysis(ctx context.Context, projectUUID uuid.UUID) error {
+        // Only a ready project is analysed, or an analyzing one whose worker died; a job left
+        // for a project that was cancelled or already analysed does nothing
+        err := a.transitionProject(ctx, a.db, projectUUID, models.ProjectAnalyzing)
+        var stateErr *StateError
+        if errors.As(err, &stateErr) {
+                log.Printf("Skipping analysis of project %s: %v", projectUUID, err)
+                return nil
+        } else if err != nil {
+                return err
+        }
+
+        var input *analysisInput
+        err = a.runStage(ctx, projectUUID, models.AnalysisStagePrepare, func() (err error) {
+                input, err = a.prepareAnalysis(ctx, projectUUID)
+                return err
+        })
+        if err != nil {
+                return err
         }
 
-        return json.RawMessage(resultJSON), nil
+        // Perform comprehensive analysis
+        var finalAnalysis json.RawMessage
+        err = a.runStage(ctx, projectUUID, models.AnalysisStageAI, func() (err error) {
+                finalAnalysis, err = a.performFinalAnalysis(ctx, input)
+                return err
+        })
+        if err != nil {
+                return err
+        }
+
+        // Save analysis results
+        var saved bool
+        err = a.runStage(ctx, projectUUID, models.AnalysisStageSave, func() (err error) {
+                saved, err = a.saveAnalysis(ctx, projectUUID, finalAnalysis)
+                return err
+        })
+        if err != nil {
+                return err
+        }
+        if !saved {
+                log.Printf("Project %s was cancelled during its analysis, result discarded", projectUUID)
+                return nil
+        }
+
+        log.Printf("Successfully completed analysis for project %s", projectUUID)
+        return nil
 }
 
-func (a *Analyzer) processAnalysis(projectUUID uuid.UUID) {
+// saveAnalysis stores the final analysis and completes the project. Nothing is saved when the
+// project was cancelled meanwhile.
+func (a *Analyzer) saveAnalysis(ctx context.Context, projectUUID uuid.UUID, finalAnalysis json.RawMessage) (bool, error) {
+        tx, err := a.db.Begin(ctx)
+        if err != nil {
+                return false, err
+        }
+        defer tx.Rollback(ctx)
+
+        err = a.transitionProject(ctx, tx, projectUUID, models.ProjectCompleted)
+        var stateErr *StateError
+        if errors.As(err, &stateErr) {
+                return false, nil
+        } else if err != nil {
+                return false, err
+        }
+
+        _, err = tx.Exec(ctx,
+                `UPDATE analysis_results 
+                 SET final_analysis = $1, status = 'completed', error_message = NULL, completed_at = $2 
+                 WHERE project_uuid = $3`,
+                finalAnalysis, time.Now(), projectUUID)
+        if err != nil {
+                return false, err
+        }
+
+        return true, tx.Commit(ctx)
+}
+
+// prepareAnalysis marks the analysis as processing, loads everything the final analysis
+// needs and runs the deterministic checks
+func (a *Analyzer) prepareAnalysis(ctx context.Context, projectUUID uuid.UUID) (*analysisInput, error) {
         // Update status to processing
-        _, err := a.db.Exec(context.Background(),
+        _, err := a.db.Exec(ctx,
                 "UPDATE analysis_results SET status = 'processing' WHERE project_uuid = $1",
                 projectUUID)
         if err != nil {
-                log.Printf("Failed to update analysis status for %s: %v", projectUUID, err)
-                return
+                return nil, fmt.Errorf("failed to update analysis status: %w", err)
         }
 
         // Get project information
-        project, err := a.getProject(projectUUID)
+        project, err := a.GetProject(ctx, projectUUID)
         if err != nil {
-                a.markAnalysisFailed(projectUUID, fmt.Sprintf("Failed to get project: %v", err))
-                return
+                return nil, fmt.Errorf("failed to get project: %w", err)
         }
 
         // Get project files
-        files, err := a.getProjectFiles(projectUUID)
+        files, err := a.getProjectFiles(ctx, projectUUID)
         if err != nil {
-                a.markAnalysisFailed(projectUUID, fmt.Sprintf("Failed to get project files: %v", err))
-                return
+                return nil, fmt.Errorf("failed to get project files: %w", err)
+        }
+
+        // Promote suspicions backed up by other files; a failed pass leaves them as suspicions
+        issueChanges, err := a.CorrelateIssues(ctx, projectUUID)
+        if err != nil {
+                log.Printf("Issue correlation failed for %s: %v", projectUUID, err)
+        }
+
+        // Get file issues
+        issues, err := a.GetFileIssues(ctx, projectUUID, models.FileIssueFilter{})
+        if err != nil {
+                return nil, fmt.Errorf("failed to get file issues: %w", err)
         }
 
         // Get test results
-        testResults, err := a.getTestResults(projectUUID)
+        testResults, err := a.getTestResults(ctx, projectUUID)
         if err != nil {
-                a.markAnalysisFailed(projectUUID, fmt.Sprintf("Failed to get test results: %v", err))
-                return
+                return nil, fmt.Errorf("failed to get test results: %w", err)
         }
 
-        // Perform comprehensive analysis
-        finalAnalysis, err := a.performFinalAnalysis(project, files, testResults)
+        // Get per-endpoint metrics
+        endpoints, err := a.GetEndpointMetrics(ctx, testResults.ID)
         if err != nil {
-                a.markAnalysisFailed(projectUUID, fmt.Sprintf("AI analysis failed: %v", err))
-                return
+                return nil, fmt.Errorf("failed to get endpoint metrics: %w", err)
         }
 
-        // Save analysis results
-        now := time.Now()
-        _, err = a.db.Exec(context.Background(),
-                `UPDATE analysis_results 
-                 SET final_analysis = $1, status = 'completed', completed_at = $2 
-                 WHERE project_uuid = $3`,
-                finalAnalysis, now, projectUUID)
+        // Get the time series of the run
+        intervals, err := a.GetMetricIntervals(ctx, testResults.ID)
         if err != nil {
-                log.Printf("Failed to save analysis results for %s: %v", projectUUID, err)
-                a.markAnalysisFailed(projectUUID, fmt.Sprintf("Failed to save results: %v", err))
-                return
+                return nil, fmt.Errorf("failed to get metric intervals: %w", err)
         }
 
-        log.Printf("Successfully completed analysis for project %s", projectUUID)
+        // Compare the run with the baseline of its tenant/repo
+        baselineComparison, err := a.compareWithBaselineRun(ctx, project, testResults, endpoints)
+        if err != nil {
+                return nil, fmt.Errorf("failed to compare with baseline: %w", err)
+        }
+
+        // Decide whether the test was conducted correctly and followed the declared load profile
+        info, ignoredInfo := parseProjectInfoFields(project.ProjectInfo)
+        if len(ignoredInfo) > 0 {
+                log.Printf("Ignored unreadable project_info fields of %s: %s", projectUUID, strings.Join(ignoredInfo, ", "))
+        }
+        validity := EvaluateTestValidity(info, testResults)
+        loadProfile := EvaluateLoadProfile(info, intervals)
+        capacity := DetectCapacityLimit(info, intervals)
+
+        // Check the nonfunctional requirements
+        nfrResults := evaluateRunNFRs(info, testResults, endpoints)
+
+        return &analysisInput{
+                project:      project,
+                info:         info,
+                ignoredInfo:  ignoredInfo,
+                files:        files,
+                issues:       issues,
+                issueChanges: issueChanges,
+                testResults:  testResults,
+                endpoints:    endpoints,
+                validity:     validity,
+                nfrResults:   nfrResults,
+                loadProfile:  loadProfile,
+                capacity:     capacity,
+                baseline:     baselineComparison,
+        }, nil
+}
+
+// evaluateRunNFRs checks the nonfunctional requirements of a run; results-side NFRs are used
+// only when project_info has none
+func evaluateRunNFRs(info models.ProjectInfo, testResults *models.TestResults, endpoints []models.EndpointMetrics) []models.NFRResult {
+        nfrSource := info.NonfunctionalRequirements
+        if len(nfrSource) == 0 || string(nfrSource) == "null" {
+                nfrSource = testResults.NonfunctionalRequirements
+        }
+        rules, unparsedRules := ParseNFRRules(nfrSource)
+        actual := readActualLoad(testResults)
+        return evaluateNFRs(rules, unparsedRules, endpoints, resultTotals{
+                successful: testResults.SuccessfulCalls,
+                failed:     testResults.FailedCalls,
+                rps:        actual.rps,
+        })
 }
 
-func (a *Analyzer) getProject(projectUUID uuid.UUID) (*models.Project, error) {
+// GetProject loads the project with its test configuration
+func (a *Analyzer) GetProject(ctx context.Context, projectUUID uuid.UUID) (*models.Project, error) {
         var project models.Project
         query := `
                 SELECT id, tenant, repo, uuid, language, testing_tool, project_info, 
                        files_count, received_files_count, has_test_results, status, created_at, updated_at
                 FROM projects WHERE uuid = $1`
         
-        err := a.db.QueryRow(context.Background(), query, projectUUID).Scan(
+        err := a.db.QueryRow(ctx, query, projectUUID).Scan(
                 &project.ID, &project.Tenant, &project.Repo, &project.UUID,
                 &project.Language, &project.TestingTool, &project.ProjectInfo,
                 &project.FilesCount, &project.ReceivedFilesCount, &project.HasTestResults,
@@ -143,12 +297,12 @@ func (a *Analyzer) getProject(projectUUID uuid.UUID) (*models.Project, error) {
         return &project, err
 }
 
-func (a *Analyzer) getProjectFiles(projectUUID uuid.UUID) ([]models.ProjectFile, error) {
+func (a *Analyzer) getProjectFiles(ctx context.Context, projectUUID uuid.UUID) ([]models.ProjectFile, error) {
         query := `
-                SELECT id, project_uuid, filename, content, file_analysis, created_at
+                SELECT id, project_uuid, filename, content, file_analysis, analysis_status, analysis_error, created_at
                 FROM project_files WHERE project_uuid = $1`
         
-        rows, err := a.db.Query(context.Background(), query, projectUUID)
+        rows, err := a.db.Query(ctx, query, projectUUID)
         if err != nil {
                 return nil, err
         }
@@ -158,7 +312,7 @@ func (a *Analyzer) getProjectFiles(projectUUID uuid.UUID) ([]models.ProjectFile,
         for rows.Next() {
                 var file models.ProjectFile
                 err := rows.Scan(&file.ID, &file.ProjectUUID, &file.Filename,
-                        &file.Content, &file.FileAnalysis, &file.CreatedAt)
+                        &file.Content, &file.FileAnalysis, &file.AnalysisStatus, &file.AnalysisError, &file.CreatedAt)
                 if err != nil {
                         return nil, err
                 }
@@ -168,29 +322,85 @@ func (a *Analyzer) getProjectFiles(projectUUID uuid.UUID) ([]models.ProjectFile,
         return files, rows.Err()
 }
 
-func (a *Analyzer) getTestResults(projectUUID uuid.UUID) (*models.TestResults, error) {
+// testResultsColumns are the test_results columns scanned by queryTestResults
+const testResultsColumns = `id, project_uuid, response_time_p95, response_time_p99, 
+                       successful_calls, failed_calls, nonfunctional_requirements, raw_results,
+                       test_duration_seconds, achieved_rps, stages, created_at`
+
+func (a *Analyzer) getTestResults(ctx context.Context, projectUUID uuid.UUID) (*models.TestResults, error) {
+        return a.queryTestResults(ctx, `SELECT `+testResultsColumns+`
+                FROM test_results WHERE project_uuid = $1 ORDER BY created_at DESC LIMIT 1`, projectUUID)
+}
+
+func (a *Analyzer) getTestResultByID(ctx context.Context, id int) (*models.TestResults, error) {
+        return a.queryTestResults(ctx, `SELECT `+testResultsColumns+` FROM test_results WHERE id = $1`, id)
+}
+
+func (a *Analyzer) queryTestResults(ctx context.Context, query string, args ...interface{}) (*models.TestResults, error) {
         var testResult models.TestResults
-        query := `
-                SELECT id, project_uuid, response_time_p95, response_time_p99, 
-                       successful_calls, failed_calls, nonfunctional_requirements, raw_results, created_at
-                FROM test_results WHERE project_uuid = $1 ORDER BY created_at DESC LIMIT 1`
-        
-        err := a.db.QueryRow(context.Background(), query, projectUUID).Scan(
+        err := a.db.QueryRow(ctx, query, args...).Scan(
                 &testResult.ID, &testResult.ProjectUUID, &testResult.ResponseTimeP95,
                 &testResult.ResponseTimeP99, &testResult.SuccessfulCalls, &testResult.FailedCalls,
-                &testResult.NonfunctionalRequirements, &testResult.RawResults, &testResult.CreatedAt)
+                &testResult.NonfunctionalRequirements, &testResult.RawResults,
+                &testResult.TestDurationSeconds, &testResult.AchievedRPS, &testResult.Stages, &testResult.CreatedAt)
         
         return &testResult, err
 }
 
-func (a *Analyzer) performFinalAnalysis(project *models.Project, files []models.ProjectFile, testResults *models.TestResults) (json.RawMessage, error) {
+// analysisInput collects everything the final analysis stage works with
+type analysisInput struct {
+        project      *models.Project
+        info         models.ProjectInfo
+        ignoredInfo  []string
+        files        []models.ProjectFile
+        issues       []models.FileIssue
+        issueChanges []models.FileIssueChange
+        testResults  *models.TestResults
+        endpoints    []models.EndpointMetrics
+        validity     models.TestValidity
+        nfrResults   []models.NFRResult
+        loadProfile  models.LoadProfileConformance
+        capacity     models.CapacityEstimate
+        baseline     models.BaselineComparison
+}
+
+func (a *Analyzer) performFinalAnalysis(ctx context.Context, in *analysisInput) (json.RawMessage, error) {
+        project, files, issues, testResults := in.project, in.files, in.issues, in.testResults
+
         // Prepare comprehensive analysis prompt
+        issuesByFile := make(map[string][]models.FileIssue)
+        for _, issue := range issues {
+                issuesByFile[issue.Filename] = append(issuesByFile[issue.Filename], issue)
+        }
+
         var filesSummary strings.Builder
         filesSummary.WriteString("Файлы проекта:\n")
         for _, file := range files {
                 filesSummary.WriteString(fmt.Sprintf("- %s (размер: %d символов)\n", file.Filename, len(file.Content)))
-                if file.FileAnalysis != nil {
-                        filesSummary.WriteString(fmt.Sprintf("  Анализ: %s\n", string(file.FileAnalysis)))
+                for _, issue := range issuesByFile[file.Filename] {
+                        filesSummary.WriteString(fmt.Sprintf("  * id=%d [%s, %s] %s%s: %s\n",
+                                issue.ID, issue.Severity, issue.State, issue.Name, formatIssueLocation(issue), issue.Description))
+                }
+        }
+
+        var endpointsSummary strings.Builder
+        for _, endpoint := range in.endpoints {
+                source := ""
+                if endpoint.PercentilesSource == models.PercentilesComputed {
+                        source = " (перцентили вычислены сервисом по сырым замерам)"
+                }
+                endpointsSummary.WriteString(fmt.Sprintf("  * %s: p50=%s, p90=%s, p95=%s, p99=%s, max=%s мс, RPS=%s, запросов=%d, ошибок=%d%s\n",
+                        EndpointLabel(endpoint), formatMetric(endpoint.P50), formatMetric(endpoint.P90),
+                        formatMetric(endpoint.P95), formatMetric(endpoint.P99), formatMetric(endpoint.Max),
+                        formatMetric(endpoint.RPS), endpoint.Requests, endpoint.Errors, source))
+        }
+        if len(in.endpoints) == 0 {
+                // Legacy percentile maps the service could not turn into endpoints are passed as sent
+                if len(testResults.ResponseTimeP95) > 0 && string(testResults.ResponseTimeP95) != "null" {
+                        endpointsSummary.WriteString(fmt.Sprintf("  * Время ответа P95: %s\n", string(testResults.ResponseTimeP95)))
+                }
+                if len(testResults.ResponseTimeP99) > 0 && string(testResults.ResponseTimeP99) != "null" {
+                        endpointsSummary.WriteString(fmt.Sprintf("  * Время ответа P99: %s\n", string(testResults.ResponseTimeP99)))
                 }
         }
 
@@ -198,14 +408,71 @@ func (a *Analyzer) performFinalAnalysis(project *models.Project, files []models.
 Результаты тестирования:
 - Успешные вызовы: %d
 - Неуспешные вызовы: %d
-- 95-й перцентиль времени ответа: %s
-- 99-й перцентиль времени ответа: %s
-- Нефункциональные требования: %s
+- Метрики по методам:
+%s- Нефункциональные требования: %s
 - Дополнительные результаты: %s`,
-                testResults.SuccessfulCalls, testResults.FailedCalls,
-                string(testResults.ResponseTimeP95), string(testResults.ResponseTimeP99),
+                testResults.SuccessfulCalls, testResults.FailedCalls, endpointsSummary.String(),
                 string(testResults.NonfunctionalRequirements), string(testResults.RawResults))
 
+        var nfrSummary strings.Builder
+        if len(in.nfrResults) > 0 {
+                nfrSummary.WriteString("Проверка нефункциональных требований (вычислена сервисом, используйте как достоверные данные и не пересчитывайте):\n")
+                for _, result := range in.nfrResults {
+                        nfrSummary.WriteString(fmt.Sprintf("- %s: %s (порог: %s %g %s, фактически: %s %s) - %s\n",
+                                result.Requirement, result.Status, result.Operator, result.Threshold, result.Unit,
+                                formatMetric(result.Actual), result.Unit, result.Detail))
+                }
+                nfrSummary.WriteString("\n")
+        }
+
+        var validitySummary strings.Builder
+        validitySummary.WriteString(fmt.Sprintf("Проверка корректности проведения теста (детерминированная): корректен = %t, уверенность = %s\n",
+                in.validity.Valid, in.validity.Confidence))
+        for _, check := range in.validity.Checks {
+                validitySummary.WriteString(fmt.Sprintf("- %s: %s (ожидалось: %s, фактически: %s) - %s\n",
+                        check.Name, check.Status, check.Expected, check.Actual, check.Detail))
+        }
+
+        var loadProfileSummary strings.Builder
+        if in.loadProfile.Evaluated {
+                loadProfileSummary.WriteString(fmt.Sprintf("Соответствие профилю нагрузки (вычислено сервисом по временному ряду, используйте как достоверные данные): соответствует = %t\n",
+                        in.loadProfile.Conforms))
+                for _, stage := range in.loadProfile.Stages {
+                        loadProfileSummary.WriteString(fmt.Sprintf("- этап %s: %s, цель RPS=%g, VU=%d, пиковый RPS=%s, средний RPS=%s, p95 в начале=%s, в конце=%s мс, ошибок=%s%%\n",
+                                stage.Name, stage.Status, stage.TargetRPS, stage.TargetVUs, formatMetric(stage.PeakRPS),
+                                formatMetric(stage.MeanRPS), formatMetric(stage.P95Start), formatMetric(stage.P95End),
+                                formatMetric(stage.ErrorRatePercent)))
+                }
+                for _, finding := range in.loadProfile.Findings {
+                        loadProfileSummary.WriteString(fmt.Sprintf("- находка %s: %s\n", finding.Type, finding.Detail))
+                }
+                loadProfileSummary.WriteString("\n")
+        }
+        if in.capacity.Evaluated {
+                if in.capacity.Detected {
+                        loadProfileSummary.WriteString(fmt.Sprintf("Предел производительности (вычислен сервисом по ступеням нагрузки, используйте как достоверные данные): %s RPS на ступени %s, после нее (%s) - %s: %s\n\n",
+                                formatMetric(in.capacity.LimitRPS), in.capacity.Stage, in.capacity.KneeStage, in.capacity.Reason, in.capacity.Detail))
+                } else {
+                        loadProfileSummary.WriteString(fmt.Sprintf("Предел производительности (вычислен сервисом по ступеням нагрузки) не достигнут: %s\n\n",
+                                in.capacity.Detail))
+                }
+        }
+
+        var baselineSummary strings.Builder
+        if in.baseline.Evaluated {
+                baselineSummary.WriteString(fmt.Sprintf("Сравнение с эталонным прогоном %s (вычислено сервисом, используйте как достоверные данные): регрессий = %d, улучшений = %d\n",
+                        in.baseline.BaselineUUID, in.baseline.RegressionsCount, in.baseline.ImprovementsCount))
+                for _, metric := range in.baseline.Metrics {
+                        if metric.Status != models.ComparisonRegression && metric.Status != models.ComparisonImprovement {
+                                continue
+                        }
+                        baselineSummary.WriteString(fmt.Sprintf("- %s %s: %s (эталон: %s, сейчас: %s %s) - %s\n",
+                                metric.Endpoint, metric.Metric, metric.Status, formatMetric(metric.Baseline),
+                                formatMetric(metric.Current), metric.Unit, metric.Detail))
+                }
+                baselineSummary.WriteString("\n")
+        }
+
         prompt := fmt.Sprintf(`Проанализируйте результаты тестирования производительности как эксперт.
 Объясните простым языком пользователю:
 
@@ -218,6 +485,7 @@ func (a *Analyzer) performFinalAnalysis(project *models.Project, files []models.
 
 %s
 
+%s%s%s%s
 Предоставьте анализ в формате JSON со следующими полями:
 - summary: краткое резюме на русском языке
 - performance_assessment: общая оценка производительности (1-10)
@@ -227,26 +495,67 @@ func (a *Analyzer) performFinalAnalysis(project *models.Project, files []models.
 - code_quality_score: оценка качества кода (1-10)
 - load_test_score: оценка результатов нагрузочного тестирования (1-10)
 - overall_score: общая оценка проекта (1-10)
+- result_links: связи аномалий в результатах теста с проблемами в файлах, массив объектов с полями
+  metric (метрика, например p99 или error_rate), endpoint (метод или URL), observed_value (наблюдаемое значение),
+  file_issue_id (id проблемы из списка файлов проекта) и explanation (почему эта проблема вызывает аномалию)
+- test_validity_explanation: объяснение простым языком, корректно ли был проведен тест исходя из входных данных,
+  с опорой на результаты детерминированной проверки корректности и соответствия профилю нагрузки
+- regression_explanation: если есть регрессии относительно эталонного прогона, объяснение их вероятных причин
+  с опорой на проблемы в файлах проекта
 
 Используйте простой язык для объяснения технических вопросов.`,
                 project.Language, project.TestingTool, string(project.ProjectInfo),
-                filesSummary.String(), testSummary)
+                filesSummary.String(), testSummary, nfrSummary.String(), baselineSummary.String(), loadProfileSummary.String(), validitySummary.String())
 
-        response, err := a.aiClient.Query(prompt)
+        response, err := a.aiClient.Query(ctx, prompt)
         if err != nil {
                 return nil, err
         }
 
+        // Keep the model's answer as a JSON object when it is one
+        var aiAnalysis interface{} = response.Content
+        var parsed struct {
+                ResultLinks             []aiResultLink `json:"result_links"`
+                TestValidityExplanation string         `json:"test_validity_explanation"`
+        }
+        var parsedContent map[string]interface{}
+        if err := parseJSONContent(response.Content, &parsedContent); err == nil {
+                aiAnalysis = parsedContent
+                if err := parseJSONContent(response.Content, &parsed); err != nil {
+                        log.Printf("Failed to parse result links for %s: %v", project.UUID, err)
+                }
+        } else {
+                log.Printf("Final analysis for %s is not JSON: %v", project.UUID, err)
+        }
+
+        validity := in.validity
+        validity.AIExplanation = parsed.TestValidityExplanation
+
         // Structure the final analysis
         finalAnalysis := map[string]interface{}{
-                "ai_analysis":    response.Content,
+                "ai_analysis":    aiAnalysis,
+                "result_links":   buildResultLinks(parsed.ResultLinks, issues),
                 "project_info": map[string]interface{}{
                         "tenant":       project.Tenant,
                         "repo":         project.Repo,
                         "language":     project.Language,
                         "testing_tool": project.TestingTool,
+                        // Fields of the wrong type are left out of the checks
+                        "ignored_fields": in.ignoredInfo,
                 },
                 "files_count":    len(files),
+                "file_issues":    issues,
+                "issues_summary": summarizeFileIssues(issues),
+                "issue_changes":  in.issueChanges,
+                "test_validity":  validity,
+                "load_profile":   in.loadProfile,
+                "capacity":       in.capacity,
+                "baseline_comparison": in.baseline,
+                "endpoint_metrics": in.endpoints,
+                "nfr_evaluation": map[string]interface{}{
+                        "results": in.nfrResults,
+                        "summary": summarizeNFRResults(in.nfrResults),
+                },
                 "test_summary": map[string]interface{}{
                         "successful_calls": testResults.SuccessfulCalls,
                         "failed_calls":     testResults.FailedCalls,
@@ -266,8 +575,46 @@ func (a *Analyzer) performFinalAnalysis(project *models.Project, files []models.
         return json.RawMessage(finalAnalysisJSON), nil
 }
 
-func (a *Analyzer) markAnalysisFailed(projectUUID uuid.UUID, errorMsg string) {
-        _, err := a.db.Exec(context.Background(),
+// formatMetric renders an optional metric value for prompts
+func formatMetric(value *float64) string {
+        if value == nil {
+                return "н/д"
+        }
+        return strconv.FormatFloat(*value, 'f', -1, 64)
+}
+
+// formatIssueLocation renders the issue's code coordinates for prompts, e.g. " (строки 10-12)"
+func formatIssueLocation(issue models.FileIssue) string {
+        if issue.LineStart == nil {
+                return ""
+        }
+        if issue.LineEnd == nil || *issue.LineEnd == *issue.LineStart {
+                return fmt.Sprintf(" (строка %d)", *issue.LineStart)
+        }
+        return fmt.Sprintf(" (строки %d-%d)", *issue.LineStart, *issue.LineEnd)
+}
+
+// markAnalysisRetrying puts an analysis that failed with a transient error back to pending
+// and its project back to ready until its job is retried
+func (a *Analyzer) markAnalysisRetrying(ctx context.Context, projectUUID uuid.UUID, errorMsg string) {
+        _, err := a.db.Exec(ctx,
+                `UPDATE analysis_results 
+                 SET status = 'pending', error_message = $1 
+                 WHERE project_uuid = $2`,
+                errorMsg, projectUUID)
+        if err != nil {
+                log.Printf("Failed to mark analysis as retrying for %s: %v", projectUUID, err)
+        }
+
+        // A job stopped before it started the analysis finds the project still ready
+        err = a.transitionProject(ctx, a.db, projectUUID, models.ProjectReady)
+        if err != nil && !isProjectState(err, models.ProjectReady) {
+                log.Printf("Failed to move project %s back to ready: %v", projectUUID, err)
+        }
+}
+
+func (a *Analyzer) markAnalysisFailed(ctx context.Context, projectUUID uuid.UUID, errorMsg string) {
+        _, err := a.db.Exec(ctx,
                 `UPDATE analysis_results 
                  SET status = 'failed', error_message = $1 
                  WHERE project_uuid = $2`,
@@ -275,4 +622,8 @@ func (a *Analyzer) markAnalysisFailed(projectUUID uuid.UUID, errorMsg string) {
         if err != nil {
                 log.Printf("Failed to mark analysis as failed for %s: %v", projectUUID, err)
         }
+
+        if err := a.transitionProject(ctx, a.db, projectUUID, models.ProjectFailed); err != nil {
+                log.Printf("Failed to mark project %s as failed: %v", projectUUID, err)
+        }
 }
@@ -0,0 +1,349 @@
+package services
+
+import (
+        "context"
+        "errors"
+        "fmt"
+        "math"
+
+        "github.com/jackc/pgx/v5"
+        "github.com/performance-analyzer/models"
+)
+
+// DefaultRegressionTolerances apply to every tolerance not set when the baseline was marked
+var DefaultRegressionTolerances = models.RegressionTolerances{
+        LatencyPercent:    10,
+        ErrorRatePoints:   1,
+        ThroughputPercent: 10,
+        SignificanceLevel: 0.05,
+}
+
+// NormalizeRegressionTolerances validates tolerances and fills the unset ones with the defaults
+func NormalizeRegressionTolerances(tolerances *models.RegressionTolerances) (models.RegressionTolerances, error) {
+        normalized := DefaultRegressionTolerances
+        if tolerances == nil {
+                return normalized, nil
+        }
+        if tolerances.LatencyPercent < 0 || tolerances.ErrorRatePoints < 0 || tolerances.ThroughputPercent < 0 {
+                return normalized, fmt.Errorf("tolerances cannot be negative")
+        }
+        if tolerances.SignificanceLevel < 0 || tolerances.SignificanceLevel >= 1 {
+                return normalized, fmt.Errorf("significance_level must be between 0 and 1")
+        }
+
+        if tolerances.LatencyPercent > 0 {
+                normalized.LatencyPercent = tolerances.LatencyPercent
+        }
+        if tolerances.ErrorRatePoints > 0 {
+                normalized.ErrorRatePoints = tolerances.ErrorRatePoints
+        }
+        if tolerances.ThroughputPercent > 0 {
+                normalized.ThroughputPercent = tolerances.ThroughputPercent
+        }
+        if tolerances.SignificanceLevel > 0 {
+                normalized.SignificanceLevel = tolerances.SignificanceLevel
+        }
+        return normalized, nil
+}
+
+// SetBaseline marks the latest test results of the project as the baseline of its tenant/repo,
+// replacing the previous one. It returns pgx.ErrNoRows when the project has no test results.
+func (a *Analyzer) SetBaseline(ctx context.Context, project *models.Project, tolerances models.RegressionTolerances) (*models.Baseline, error) {
+        testResults, err := a.getTestResults(ctx, project.UUID)
+        if err != nil {
+                return nil, err
+        }
+
+        baseline := models.Baseline{
+                Tenant:       project.Tenant,
+                Repo:         project.Repo,
+                ProjectUUID:  project.UUID,
+                TestResultID: testResults.ID,
+                Tolerances:   tolerances,
+        }
+        query := `
+                INSERT INTO baselines (tenant, repo, project_uuid, test_result_id, tolerances)
+                VALUES ($1, $2, $3, $4, $5)
+                ON CONFLICT (tenant, repo)
+                DO UPDATE SET project_uuid = EXCLUDED.project_uuid, test_result_id = EXCLUDED.test_result_id,
+                              tolerances = EXCLUDED.tolerances, created_at = CURRENT_TIMESTAMP
+                RETURNING id, created_at`
+
+        err = a.db.QueryRow(ctx, query,
+                baseline.Tenant, baseline.Repo, baseline.ProjectUUID, baseline.TestResultID, baseline.Tolerances).
+                Scan(&baseline.ID, &baseline.CreatedAt)
+        if err != nil {
+                return nil, err
+        }
+        return &baseline, nil
+}
+
+// GetBaseline returns the baseline of a tenant/repo, or nil when none was marked
+func (a *Analyzer) GetBaseline(ctx context.Context, tenant, repo string) (*models.Baseline, error) {
+        var baseline models.Baseline
+        query := `
+                SELECT id, tenant, repo, project_uuid, test_result_id, tolerances, created_at
+                FROM baselines WHERE tenant = $1 AND repo = $2`
+
+        err := a.db.QueryRow(ctx, query, tenant, repo).Scan(
+                &baseline.ID, &baseline.Tenant, &baseline.Repo, &baseline.ProjectUUID,
+                &baseline.TestResultID, &baseline.Tolerances, &baseline.CreatedAt)
+        if errors.Is(err, pgx.ErrNoRows) {
+                return nil, nil
+        }
+        if err != nil {
+                return nil, err
+        }
+
+        // Tolerances left unset in the stored row fall back to the defaults
+        baseline.Tolerances, _ = NormalizeRegressionTolerances(&baseline.Tolerances)
+        return &baseline, nil
+}
+
+// compareWithBaselineRun loads the baseline of the project's tenant/repo and compares the run with it
+func (a *Analyzer) compareWithBaselineRun(ctx context.Context, project *models.Project, testResults *models.TestResults, endpoints []models.EndpointMetrics) (models.BaselineComparison, error) {
+        baseline, err := a.GetBaseline(ctx, project.Tenant, project.Repo)
+        if err != nil {
+                return models.BaselineComparison{}, err
+        }
+        if baseline == nil {
+                return models.BaselineComparison{
+                        Tolerances: DefaultRegressionTolerances,
+                        Detail:     "No baseline is set for this tenant and repo",
+                        Metrics:    []models.MetricComparison{},
+                }, nil
+        }
+        if baseline.TestResultID == testResults.ID {
+                return models.BaselineComparison{
+                        BaselineUUID:  &baseline.ProjectUUID,
+                        BaselineSetAt: &baseline.CreatedAt,
+                        Tolerances:    baseline.Tolerances,
+                        Detail:        "This run is the baseline",
+                        Metrics:       []models.MetricComparison{},
+                }, nil
+        }
+
+        baselineResults, err := a.getTestResultByID(ctx, baseline.TestResultID)
+        if err != nil {
+                return models.BaselineComparison{}, err
+        }
+        baselineEndpoints, err := a.GetEndpointMetrics(ctx, baseline.TestResultID)
+        if err != nil {
+                return models.BaselineComparison{}, err
+        }
+
+        comparison := CompareRuns(baseline.Tolerances, "the baseline", baselineResults, baselineEndpoints, testResults, endpoints)
+        comparison.BaselineUUID = &baseline.ProjectUUID
+        comparison.BaselineSetAt = &baseline.CreatedAt
+        return comparison, nil
+}
+
+// CompareRuns compares the run-wide throughput and error rate and the per-endpoint percentiles,
+// error rates and throughput of a run with a reference run, named in the detail by referenceName.
+// A latency change beyond the tolerance counts only when the Kolmogorov-Smirnov test confirms
+// it, if both endpoints have raw samples.
+func CompareRuns(tolerances models.RegressionTolerances, referenceName string, referenceResults *models.TestResults, referenceEndpoints []models.EndpointMetrics,
+        testResults *models.TestResults, endpoints []models.EndpointMetrics) models.BaselineComparison {
+        comparison := models.BaselineComparison{
+                Evaluated:  true,
+                Tolerances: tolerances,
+                Metrics:    []models.MetricComparison{},
+        }
+
+        reference, actual := readActualLoad(referenceResults), readActualLoad(testResults)
+        comparison.Metrics = append(comparison.Metrics,
+                compareThroughput("all requests", positive(reference.rps), positive(actual.rps), tolerances),
+                compareErrorRate("all requests", callsErrorRate(reference), callsErrorRate(actual), tolerances))
+
+        current := make(map[string]models.EndpointMetrics, len(endpoints))
+        for _, endpoint := range endpoints {
+                current[EndpointLabel(endpoint)] = endpoint
+        }
+
+        for _, base := range referenceEndpoints {
+                label := EndpointLabel(base)
+                endpoint, ok := current[label]
+                if !ok {
+                        comparison.Metrics = append(comparison.Metrics, models.MetricComparison{
+                                Endpoint: label,
+                                Metric:   "endpoint",
+                                Status:   models.ComparisonMissing,
+                                Detail:   "The endpoint was not called in this run",
+                        })
+                        continue
+                }
+
+                // One test covers the whole latency distribution of the endpoint
+                var ks *ksResult
+                if base.Histogram != nil && endpoint.Histogram != nil {
+                        distance, pValue := kolmogorovSmirnov(base.Histogram, endpoint.Histogram)
+                        ks = &ksResult{distance: distance, pValue: pValue, significant: pValue < tolerances.SignificanceLevel}
+                }
+
+                for _, percentile := range []struct {
+                        name            string
+                        baseline, value *float64
+                }{
+                        {"p50", base.P50, endpoint.P50},
+                        {"p90", base.P90, endpoint.P90},
+                        {"p95", base.P95, endpoint.P95},
+                        {"p99", base.P99, endpoint.P99},
+                } {
+                        if percentile.baseline == nil || percentile.value == nil {
+                                continue
+                        }
+                        comparison.Metrics = append(comparison.Metrics,
+                                compareLatency(label, percentile.name, percentile.baseline, percentile.value, ks, tolerances))
+                }
+
+                comparison.Metrics = append(comparison.Metrics,
+                        compareErrorRate(label, endpointErrorRate(base), endpointErrorRate(endpoint), tolerances))
+                if base.RPS != nil && endpoint.RPS != nil {
+                        comparison.Metrics = append(comparison.Metrics, compareThroughput(label, base.RPS, endpoint.RPS, tolerances))
+                }
+        }
+
+        for _, metric := range comparison.Metrics {
+                switch metric.Status {
+                case models.ComparisonRegression:
+                        comparison.RegressionsCount++
+                case models.ComparisonImprovement:
+                        comparison.ImprovementsCount++
+                }
+        }
+        comparison.Regressed = comparison.RegressionsCount > 0
+        if comparison.Regressed {
+                comparison.Detail = fmt.Sprintf("%d metrics regressed against %s", comparison.RegressionsCount, referenceName)
+        } else {
+                comparison.Detail = "No metric regressed against " + referenceName
+        }
+
+        return comparison
+}
+
+// ksResult is the outcome of the Kolmogorov-Smirnov test of one endpoint
+type ksResult struct {
+        distance    float64
+        pValue      float64
+        significant bool
+}
+
+func compareLatency(endpoint, metric string, baseline, value *float64, ks *ksResult, tolerances models.RegressionTolerances) models.MetricComparison {
+        comparison := models.MetricComparison{
+                Endpoint: endpoint,
+                Metric:   metric,
+                Baseline: baseline,
+                Current:  value,
+                Unit:     "ms",
+                Status:   models.ComparisonUnchanged,
+        }
+        if ks != nil {
+                distance, pValue, significant := ks.distance, ks.pValue, ks.significant
+                comparison.KSStatistic, comparison.PValue, comparison.Significant = &distance, &pValue, &significant
+        }
+        if *baseline <= 0 {
+                comparison.Detail = "The baseline value is zero"
+                return comparison
+        }
+
+        change := (*value - *baseline) / *baseline * 100
+        comparison.Change = &change
+        if math.Abs(change) <= tolerances.LatencyPercent {
+                comparison.Detail = fmt.Sprintf("Changed by %+.1f%%, within the %.1f%% tolerance", change, tolerances.LatencyPercent)
+                return comparison
+        }
+        if ks != nil && !ks.significant {
+                comparison.Detail = fmt.Sprintf("Changed by %+.1f%%, but the distributions do not differ significantly (p=%.3f)", change, ks.pValue)
+                return comparison
+        }
+
+        if change > 0 {
+                comparison.Status = models.ComparisonRegression
+                comparison.Detail = fmt.Sprintf("%s grew from %.1f to %.1f ms (%+.1f%%)", metric, *baseline, *value, change)
+        } else {
+                comparison.Status = models.ComparisonImprovement
+                comparison.Detail = fmt.Sprintf("%s fell from %.1f to %.1f ms (%+.1f%%)", metric, *baseline, *value, change)
+        }
+        return comparison
+}
+
+func compareErrorRate(endpoint string, baseline, value *float64, tolerances models.RegressionTolerances) models.MetricComparison {
+        comparison := models.MetricComparison{
+                Endpoint: endpoint,
+                Metric:   "error_rate",
+                Baseline: baseline,
+                Current:  value,
+                Unit:     "%",
+                Status:   models.ComparisonUnchanged,
+        }
+        if baseline == nil || value == nil {
+                comparison.Detail = "No requests to compare"
+                return comparison
+        }
+
+        change := *value - *baseline
+        comparison.Change = &change
+        switch {
+        case change > tolerances.ErrorRatePoints:
+                comparison.Status = models.ComparisonRegression
+                comparison.Detail = fmt.Sprintf("Error rate grew from %.2f%% to %.2f%%", *baseline, *value)
+        case change < -tolerances.ErrorRatePoints:
+                comparison.Status = models.ComparisonImprovement
+                comparison.Detail = fmt.Sprintf("Error rate fell from %.2f%% to %.2f%%", *baseline, *value)
+        default:
+                comparison.Detail = fmt.Sprintf("Changed by %+.2f percentage points, within the %.2f tolerance", change, tolerances.ErrorRatePoints)
+        }
+        return comparison
+}
+
+func compareThroughput(endpoint string, baseline, value *float64, tolerances models.RegressionTolerances) models.MetricComparison {
+        comparison := models.MetricComparison{
+                Endpoint: endpoint,
+                Metric:   "throughput",
+                Baseline: baseline,
+                Current:  value,
+                Unit:     "rps",
+                Status:   models.ComparisonUnchanged,
+        }
+        if baseline == nil || value == nil || *baseline <= 0 {
+                comparison.Detail = "Throughput is not known for both runs"
+                return comparison
+        }
+
+        change := (*value - *baseline) / *baseline * 100
+        comparison.Change = &change
+        switch {
+        case change < -tolerances.ThroughputPercent:
+                comparison.Status = models.ComparisonRegression
+                comparison.Detail = fmt.Sprintf("Throughput fell from %.1f to %.1f RPS (%+.1f%%)", *baseline, *value, change)
+        case change > tolerances.ThroughputPercent:
+                comparison.Status = models.ComparisonImprovement
+                comparison.Detail = fmt.Sprintf("Throughput grew from %.1f to %.1f RPS (%+.1f%%)", *baseline, *value, change)
+        default:
+                comparison.Detail = fmt.Sprintf("Changed by %+.1f%%, within the %.1f%% tolerance", change, tolerances.ThroughputPercent)
+        }
+        return comparison
+}
+
+func callsErrorRate(load actualLoad) *float64 {
+        if load.totalCalls == 0 {
+                return nil
+        }
+        rate := load.errorRate
+        return &rate
+}
+
+func endpointErrorRate(endpoint models.EndpointMetrics) *float64 {
+        if endpoint.Requests == 0 {
+                return nil
+        }
+        rate := float64(endpoint.Errors) / float64(endpoint.Requests) * 100
+        return &rate
+}
+
+func positive(value float64) *float64 {
+        if value <= 0 {
+                return nil
+        }
+        return &value
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+        "fmt"
+        "sort"
+
+        "github.com/performance-analyzer/models"
+)
+
+const (
+        // kneeLatencySlope is how much faster than throughput latency may grow between two steps
+        kneeLatencySlope = 2.0
+        // kneeLatencyGrowth is the growth over the first step latency must also reach, so noise
+        // at low latencies is not taken for a knee
+        kneeLatencyGrowth = 1.5
+        // errorSpikePercent is the error rate a step must reach to count as an error spike
+        errorSpikePercent = 1.0
+        // minStepIntervals is how many intervals at one VU level make a step when no stages are declared
+        minStepIntervals = 2
+)
+
+// DetectCapacityLimit finds the throughput level of a stepped load test after which latency
+// grows non-linearly or errors spike. Steps are the declared stages, or runs of intervals
+// at the same number of virtual users when no stages are declared.
+func DetectCapacityLimit(info models.ProjectInfo, intervals []models.MetricInterval) models.CapacityEstimate {
+        estimate := models.CapacityEstimate{Steps: []models.LoadStep{}}
+        if len(intervals) == 0 {
+                estimate.Detail = "No time-series metrics were submitted"
+                return estimate
+        }
+
+        steps, levels := loadSteps(info, intervals)
+        if len(steps) < 2 {
+                estimate.Detail = "The test has fewer than two load steps, a capacity limit cannot be located"
+                return estimate
+        }
+        estimate.Evaluated = true
+        estimate.Steps = steps
+
+        baseline := steps[0]
+        for i := 1; i < len(steps); i++ {
+                previous, current := steps[i-1], steps[i]
+                reason, detail := kneeBetween(baseline, previous, current, levels[i] > levels[i-1])
+                if reason == "" {
+                        continue
+                }
+
+                estimate.Detected = true
+                estimate.Reason = reason
+                estimate.LimitRPS = previous.RPS
+                estimate.LimitVUs = previous.VUs
+                estimate.LimitP95 = previous.P95
+                estimate.Stage = previous.Name
+                estimate.KneeStage = current.Name
+                estimate.Detail = detail
+                return estimate
+        }
+
+        // No knee: the system scaled up to the highest step, which is a lower bound of its capacity
+        highest := steps[0]
+        for _, step := range steps[1:] {
+                if step.RPS != nil && (highest.RPS == nil || *step.RPS > *highest.RPS) {
+                        highest = step
+                }
+        }
+        estimate.LimitRPS = highest.RPS
+        estimate.LimitVUs = highest.VUs
+        estimate.LimitP95 = highest.P95
+        estimate.Stage = highest.Name
+        estimate.Detail = fmt.Sprintf("Latency and errors stayed proportional to load up to %s RPS, the capacity is at least this level",
+                formatMetric(highest.RPS))
+        return estimate
+}
+
+// kneeBetween compares two consecutive steps and reports why the second is past the knee;
+// loadGrew tells whether the second step applied more load than the first
+func kneeBetween(baseline, previous, current models.LoadStep, loadGrew bool) (string, string) {
+        if current.ErrorRatePercent != nil && *current.ErrorRatePercent >= errorSpikePercent {
+                prevRate := 0.0
+                if previous.ErrorRatePercent != nil {
+                        prevRate = *previous.ErrorRatePercent
+                }
+                if *current.ErrorRatePercent >= prevRate*2 && *current.ErrorRatePercent >= prevRate+errorSpikePercent {
+                        return models.CapacityErrorSpike, fmt.Sprintf("Errors rose from %.2f%% at step %s to %.2f%% at step %s",
+                                prevRate, previous.Name, *current.ErrorRatePercent, current.Name)
+                }
+        }
+
+        if previous.RPS == nil || current.RPS == nil || previous.P95 == nil || current.P95 == nil ||
+                baseline.P95 == nil || *previous.RPS <= 0 || *previous.P95 <= 0 {
+                return "", ""
+        }
+        latencyGrowth := (*current.P95 - *previous.P95) / *previous.P95
+        throughputGrowth := (*current.RPS - *previous.RPS) / *previous.RPS
+        if *current.P95 < *baseline.P95*kneeLatencyGrowth {
+                return "", ""
+        }
+
+        // More load that brings no more throughput only queues requests
+        if loadGrew && throughputGrowth <= 0.05 && latencyGrowth > 0.2 {
+                return models.CapacityThroughputPlateau, fmt.Sprintf("Throughput stayed at %.1f RPS from step %s to step %s while p95 grew from %.1f to %.1f ms",
+                        *previous.RPS, previous.Name, current.Name, *previous.P95, *current.P95)
+        }
+        if throughputGrowth > 0 && latencyGrowth > throughputGrowth*kneeLatencySlope {
+                return models.CapacityLatencyKnee, fmt.Sprintf("From step %s to step %s throughput grew by %.0f%% and p95 by %.0f%% (%.1f to %.1f ms)",
+                        previous.Name, current.Name, throughputGrowth*100, latencyGrowth*100, *previous.P95, *current.P95)
+        }
+        return "", ""
+}
+
+// loadSteps groups the intervals into the load levels of the test and returns them with the
+// load each step applies; steps after the load starts going down (a ramp-down) are left out
+func loadSteps(info models.ProjectInfo, intervals []models.MetricInterval) ([]models.LoadStep, []float64) {
+        var steps []models.LoadStep
+        var levels []float64
+
+        stages, _ := plannedStages(info)
+        if len(stages) >= 2 {
+                origin := intervals[0].Start
+                for _, stage := range stages {
+                        selected := intervalsInWindow(intervals, origin.Add(stage.offset), origin.Add(stage.offset+stage.duration))
+                        if len(selected) == 0 {
+                                continue
+                        }
+                        step := summarizeStep(stage.name, selected)
+                        level := stage.targetRPS
+                        if level == 0 {
+                                level = float64(stage.targetVUs)
+                        }
+                        if level == 0 && step.RPS != nil {
+                                level = *step.RPS
+                        }
+                        steps = append(steps, step)
+                        levels = append(levels, level)
+                }
+        } else {
+                for start := 0; start < len(intervals); {
+                        end := start + 1
+                        for end < len(intervals) && sameVUs(intervals[start], intervals[end]) {
+                                end++
+                        }
+                        if intervals[start].ActiveVUs != nil && end-start >= minStepIntervals {
+                                steps = append(steps, summarizeStep(fmt.Sprintf("%d VUs", *intervals[start].ActiveVUs), intervals[start:end]))
+                                levels = append(levels, float64(*intervals[start].ActiveVUs))
+                        }
+                        start = end
+                }
+        }
+
+        for i := 1; i < len(levels); i++ {
+                if levels[i] < levels[i-1] {
+                        return steps[:i], levels[:i]
+                }
+        }
+        return steps, levels
+}
+
+func sameVUs(a, b models.MetricInterval) bool {
+        return a.ActiveVUs != nil && b.ActiveVUs != nil && *a.ActiveVUs == *b.ActiveVUs
+}
+
+// summarizeStep measures a step: mean throughput, the median of interval p95 (robust to a
+// single slow interval), peak VUs and the error rate
+func summarizeStep(name string, intervals []models.MetricInterval) models.LoadStep {
+        step := models.LoadStep{
+                Name:      name,
+                Intervals: len(intervals),
+                RPS:       meanIntervalValue(intervals, func(i models.MetricInterval) *float64 { return i.RPS }),
+        }
+
+        var p95s []float64
+        var requests, errors int
+        for _, interval := range intervals {
+                if interval.P95 != nil {
+                        p95s = append(p95s, *interval.P95)
+                }
+                if interval.ActiveVUs != nil && (step.VUs == nil || *interval.ActiveVUs > *step.VUs) {
+                        vus := *interval.ActiveVUs
+                        step.VUs = &vus
+                }
+                requests += interval.Requests
+                errors += interval.Errors
+        }
+        if len(p95s) > 0 {
+                sort.Float64s(p95s)
+                median := p95s[len(p95s)/2]
+                if len(p95s)%2 == 0 {
+                        median = (p95s[len(p95s)/2-1] + median) / 2
+                }
+                step.P95 = &median
+        }
+        if requests > 0 {
+                rate := float64(errors) / float64(requests) * 100
+                step.ErrorRatePercent = &rate
+        }
+        return step
+}
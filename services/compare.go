@@ -0,0 +1,271 @@
+package services
+
+import (
+        "context"
+        "encoding/json"
+        "errors"
+        "fmt"
+        "log"
+        "strconv"
+        "strings"
+
+        "github.com/jackc/pgx/v5"
+        "github.com/performance-analyzer/models"
+)
+
+// comparedScores are the scores of the final analysis compared between runs
+var comparedScores = []string{"overall_score", "performance_assessment", "code_quality_score", "load_test_score"}
+
+// CompareProjects diffs two runs: endpoint metrics, NFR outcomes, file issues and AI scores.
+// With narrative set the AI model also explains the changes. It returns pgx.ErrNoRows when
+// either project has no test results.
+func (a *Analyzer) CompareProjects(ctx context.Context, projectA, projectB *models.Project, narrative bool) (*models.RunComparison, error) {
+        comparison := &models.RunComparison{
+                UUIDA:    projectA.UUID,
+                UUIDB:    projectB.UUID,
+                SameRepo: projectA.Tenant == projectB.Tenant && projectA.Repo == projectB.Repo,
+        }
+
+        resultsA, endpointsA, err := a.loadRun(ctx, projectA)
+        if err != nil {
+                return nil, err
+        }
+        resultsB, endpointsB, err := a.loadRun(ctx, projectB)
+        if err != nil {
+                return nil, err
+        }
+
+        comparison.Metrics = CompareRuns(DefaultRegressionTolerances, "run A", resultsA, endpointsA, resultsB, endpointsB)
+        comparison.NFRChanges = diffNFRResults(
+                evaluateRunNFRs(parseProjectInfo(projectA.ProjectInfo), resultsA, endpointsA),
+                evaluateRunNFRs(parseProjectInfo(projectB.ProjectInfo), resultsB, endpointsB))
+
+        issuesA, err := a.GetFileIssues(ctx, projectA.UUID, models.FileIssueFilter{})
+        if err != nil {
+                return nil, err
+        }
+        issuesB, err := a.GetFileIssues(ctx, projectB.UUID, models.FileIssueFilter{})
+        if err != nil {
+                return nil, err
+        }
+        comparison.IssuesAppeared, comparison.IssuesDisappeared, comparison.IssuesPersisted = diffFileIssues(issuesA, issuesB)
+
+        scoresA, err := a.getAnalysisScores(ctx, projectA)
+        if err != nil {
+                return nil, err
+        }
+        scoresB, err := a.getAnalysisScores(ctx, projectB)
+        if err != nil {
+                return nil, err
+        }
+        comparison.Scores = []models.ScoreChange{}
+        for _, name := range comparedScores {
+                change := models.ScoreChange{Name: name, A: scoresA[name], B: scoresB[name]}
+                if change.A != nil && change.B != nil {
+                        delta := *change.B - *change.A
+                        change.Delta = &delta
+                }
+                comparison.Scores = append(comparison.Scores, change)
+        }
+
+        if narrative {
+                response, err := a.aiClient.Query(ctx, comparisonPrompt(comparison))
+                if err != nil {
+                        log.Printf("Failed to get comparison narrative for %s and %s: %v", projectA.UUID, projectB.UUID, err)
+                } else {
+                        comparison.Narrative = &response.Content
+                }
+        }
+
+        return comparison, nil
+}
+
+// loadRun loads the latest test results of a project with their endpoint metrics
+func (a *Analyzer) loadRun(ctx context.Context, project *models.Project) (*models.TestResults, []models.EndpointMetrics, error) {
+        testResults, err := a.getTestResults(ctx, project.UUID)
+        if err != nil {
+                return nil, nil, err
+        }
+        endpoints, err := a.GetEndpointMetrics(ctx, testResults.ID)
+        if err != nil {
+                return nil, nil, err
+        }
+        return testResults, endpoints, nil
+}
+
+// getAnalysisScores reads the AI scores of the latest completed final analysis;
+// a project without one has no scores
+func (a *Analyzer) getAnalysisScores(ctx context.Context, project *models.Project) (map[string]*float64, error) {
+        var finalAnalysis json.RawMessage
+        err := a.db.QueryRow(ctx,
+                `SELECT final_analysis FROM analysis_results
+                 WHERE project_uuid = $1 AND status = 'completed'
+                 ORDER BY created_at DESC LIMIT 1`, project.UUID).Scan(&finalAnalysis)
+        if errors.Is(err, pgx.ErrNoRows) {
+                return map[string]*float64{}, nil
+        }
+        if err != nil {
+                return nil, err
+        }
+
+        var analysis struct {
+                AIAnalysis map[string]interface{} `json:"ai_analysis"`
+        }
+        json.Unmarshal(finalAnalysis, &analysis)
+
+        scores := make(map[string]*float64)
+        for _, name := range comparedScores {
+                scores[name] = parseScore(analysis.AIAnalysis[name])
+        }
+        return scores, nil
+}
+
+// parseScore reads a score the model wrote as a number, a numeric string or text like "7/10"
+func parseScore(value interface{}) *float64 {
+        switch v := value.(type) {
+        case float64:
+                return &v
+        case string:
+                text := strings.TrimSpace(v)
+                if i := strings.Index(text, "/"); i >= 0 {
+                        text = strings.TrimSpace(text[:i])
+                }
+                if score, err := strconv.ParseFloat(text, 64); err == nil {
+                        return &score
+                }
+        }
+        return nil
+}
+
+// diffNFRResults pairs the NFR outcomes of two runs by requirement and endpoint
+func diffNFRResults(resultsA, resultsB []models.NFRResult) []models.NFRChange {
+        key := func(result models.NFRResult) string {
+                return result.Requirement + "|" + result.Endpoint
+        }
+
+        byKey := make(map[string]models.NFRResult, len(resultsB))
+        for _, result := range resultsB {
+                byKey[key(result)] = result
+        }
+
+        changes := []models.NFRChange{}
+        for _, resultA := range resultsA {
+                change := models.NFRChange{
+                        Requirement: resultA.Requirement,
+                        StatusA:     resultA.Status,
+                        StatusB:     models.ComparisonMissing,
+                        ActualA:     resultA.Actual,
+                        Unit:        resultA.Unit,
+                }
+                if resultB, ok := byKey[key(resultA)]; ok {
+                        change.StatusB = resultB.Status
+                        change.ActualB = resultB.Actual
+                        delete(byKey, key(resultA))
+                }
+                change.Changed = change.StatusA != change.StatusB
+                changes = append(changes, change)
+        }
+        for _, resultB := range resultsB {
+                if _, ok := byKey[key(resultB)]; !ok {
+                        continue
+                }
+                changes = append(changes, models.NFRChange{
+                        Requirement: resultB.Requirement,
+                        StatusA:     models.ComparisonMissing,
+                        StatusB:     resultB.Status,
+                        ActualB:     resultB.Actual,
+                        Unit:        resultB.Unit,
+                        Changed:     true,
+                })
+        }
+        return changes
+}
+
+// diffFileIssues matches the issues of two runs by file, name and location. Issues whose
+// lines moved are matched by file and name in a second pass.
+func diffFileIssues(issuesA, issuesB []models.FileIssue) ([]models.FileIssue, []models.FileIssue, int) {
+        exactKey := func(issue models.FileIssue) string {
+                return fmt.Sprintf("%s|%s|%s", issue.Filename, strings.ToLower(issue.Name), formatIssueLocation(issue))
+        }
+        looseKey := func(issue models.FileIssue) string {
+                return issue.Filename + "|" + strings.ToLower(issue.Name)
+        }
+
+        matchedA := make([]bool, len(issuesA))
+        matchedB := make([]bool, len(issuesB))
+        persisted := 0
+        for _, key := range []func(models.FileIssue) string{exactKey, looseKey} {
+                unmatched := make(map[string][]int)
+                for i, issue := range issuesA {
+                        if !matchedA[i] {
+                                unmatched[key(issue)] = append(unmatched[key(issue)], i)
+                        }
+                }
+                for j, issue := range issuesB {
+                        if matchedB[j] {
+                                continue
+                        }
+                        if candidates := unmatched[key(issue)]; len(candidates) > 0 {
+                                matchedA[candidates[0]], matchedB[j] = true, true
+                                unmatched[key(issue)] = candidates[1:]
+                                persisted++
+                        }
+                }
+        }
+
+        appeared, disappeared := []models.FileIssue{}, []models.FileIssue{}
+        for j, issue := range issuesB {
+                if !matchedB[j] {
+                        appeared = append(appeared, issue)
+                }
+        }
+        for i, issue := range issuesA {
+                if !matchedA[i] {
+                        disappeared = append(disappeared, issue)
+                }
+        }
+        return appeared, disappeared, persisted
+}
+
+// comparisonPrompt asks the model to explain the diff of two runs
+func comparisonPrompt(comparison *models.RunComparison) string {
+        var diff strings.Builder
+        diff.WriteString("Изменения метрик:\n")
+        for _, metric := range comparison.Metrics.Metrics {
+                if metric.Status == models.ComparisonUnchanged {
+                        continue
+                }
+                diff.WriteString(fmt.Sprintf("- %s %s: %s (было: %s, стало: %s %s) - %s\n",
+                        metric.Endpoint, metric.Metric, metric.Status, formatMetric(metric.Baseline),
+                        formatMetric(metric.Current), metric.Unit, metric.Detail))
+        }
+
+        diff.WriteString("Изменения нефункциональных требований:\n")
+        for _, change := range comparison.NFRChanges {
+                if change.Changed {
+                        diff.WriteString(fmt.Sprintf("- %s: %s -> %s\n", change.Requirement, change.StatusA, change.StatusB))
+                }
+        }
+
+        diff.WriteString("Новые проблемы в файлах:\n")
+        for _, issue := range comparison.IssuesAppeared {
+                diff.WriteString(fmt.Sprintf("- %s%s [%s]: %s\n", issue.Filename, formatIssueLocation(issue), issue.Severity, issue.Name))
+        }
+        diff.WriteString("Исчезнувшие проблемы в файлах:\n")
+        for _, issue := range comparison.IssuesDisappeared {
+                diff.WriteString(fmt.Sprintf("- %s%s [%s]: %s\n", issue.Filename, formatIssueLocation(issue), issue.Severity, issue.Name))
+        }
+
+        diff.WriteString("Изменения оценок:\n")
+        for _, score := range comparison.Scores {
+                diff.WriteString(fmt.Sprintf("- %s: %s -> %s\n", score.Name, formatMetric(score.A), formatMetric(score.B)))
+        }
+
+        return fmt.Sprintf(`Сравните два прогона нагрузочного теста (A - предыдущий, B - новый) как эксперт по производительности.
+Изменения вычислены сервисом, используйте их как достоверные данные и не пересчитывайте.
+
+%s
+Кратко и простым языком на русском объясните, что изменилось между прогонами, какие изменения в коде
+(новые и исчезнувшие проблемы) вероятно вызвали изменения метрик, и стал ли прогон B лучше или хуже.
+Ответьте обычным текстом без JSON.`, diff.String())
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+        "context"
+        "fmt"
+        "log"
+        "strings"
+
+        "github.com/google/uuid"
+        "github.com/performance-analyzer/models"
+)
+
+// correlationDecision is the model's verdict on a single open suspicion
+type correlationDecision struct {
+        IssueID            int    `json:"issue_id"`
+        State              string `json:"state"`
+        Reason             string `json:"reason"`
+        SupportingIssueIDs []int  `json:"supporting_issue_ids"`
+}
+
+// CorrelateIssues re-evaluates open suspicions against the findings in the other files
+// of the project and promotes the ones backed up by other files to confirmed problems.
+// It returns the state changes it recorded.
+func (a *Analyzer) CorrelateIssues(ctx context.Context, projectUUID uuid.UUID) ([]models.FileIssueChange, error) {
+        issues, err := a.GetFileIssues(ctx, projectUUID, models.FileIssueFilter{})
+        if err != nil {
+                return nil, fmt.Errorf("failed to get file issues: %w", err)
+        }
+
+        var suspicions []models.FileIssue
+        files := make(map[string]bool)
+        byID := make(map[int]models.FileIssue)
+        for _, issue := range issues {
+                files[issue.Filename] = true
+                byID[issue.ID] = issue
+                if issue.State == models.IssueStateSuspicion {
+                        suspicions = append(suspicions, issue)
+                }
+        }
+
+        // Confirmation needs evidence from at least one other file
+        if len(suspicions) == 0 || len(files) < 2 {
+                return nil, nil
+        }
+
+        var suspicionsList, findingsList strings.Builder
+        for _, issue := range suspicions {
+                suspicionsList.WriteString(fmt.Sprintf("- id=%d, файл %s%s, [%s] %s: %s\n",
+                        issue.ID, issue.Filename, formatIssueLocation(issue), issue.Severity, issue.Name, issue.Description))
+        }
+        for _, issue := range issues {
+                findingsList.WriteString(fmt.Sprintf("- id=%d, файл %s%s, [%s, %s] %s: %s\n",
+                        issue.ID, issue.Filename, formatIssueLocation(issue), issue.Severity, issue.State, issue.Name, issue.Description))
+        }
+
+        prompt := fmt.Sprintf(`Выполните подтверждение подозрений на проблемы производительности как эксперт по тестированию производительности.
+Ниже перечислены подозрения, найденные при анализе отдельных файлов проекта, и все находки по остальным файлам.
+Подозрение считается подтвержденной проблемой, если находки в других файлах подкрепляют его
+(например, подозрительная настройка пула соединений в одном файле и неограниченное число горутин в другом).
+
+Подозрения:
+%s
+Все находки по файлам проекта:
+%s
+Ответьте в формате JSON: {"decisions": [{"issue_id": id подозрения, "state": "confirmed" или "suspicion", "reason": "объяснение", "supporting_issue_ids": [id находок из других файлов]}]}.`,
+                suspicionsList.String(), findingsList.String())
+
+        response, err := a.aiClient.Query(ctx, prompt)
+        if err != nil {
+                return nil, fmt.Errorf("AI correlation failed: %w", err)
+        }
+
+        var parsed struct {
+                Decisions []correlationDecision `json:"decisions"`
+        }
+        if err := parseJSONContent(response.Content, &parsed); err != nil {
+                return nil, err
+        }
+
+        var changes []models.FileIssueChange
+        for _, decision := range parsed.Decisions {
+                issue, ok := byID[decision.IssueID]
+                if !ok || issue.State != models.IssueStateSuspicion {
+                        continue
+                }
+                if strings.ToLower(strings.TrimSpace(decision.State)) != models.IssueStateConfirmed {
+                        continue
+                }
+
+                // Keep only evidence that really comes from other files of this project
+                var supporting []int
+                for _, id := range decision.SupportingIssueIDs {
+                        if other, ok := byID[id]; ok && other.Filename != issue.Filename {
+                                supporting = append(supporting, id)
+                        }
+                }
+                if len(supporting) == 0 {
+                        log.Printf("Ignoring confirmation of issue %d without evidence from other files", issue.ID)
+                        continue
+                }
+
+                change := models.FileIssueChange{
+                        IssueID:            issue.ID,
+                        ProjectUUID:        projectUUID,
+                        OldState:           issue.State,
+                        NewState:           models.IssueStateConfirmed,
+                        Reason:             decision.Reason,
+                        SupportingIssueIDs: supporting,
+                }
+                applied, err := a.changeIssueState(ctx, change)
+                if err != nil {
+                        return changes, fmt.Errorf("failed to update issue %d: %w", issue.ID, err)
+                }
+                if applied {
+                        changes = append(changes, change)
+                }
+        }
+
+        log.Printf("Correlation for project %s: %d of %d suspicions confirmed", projectUUID, len(changes), len(suspicions))
+        return changes, nil
+}
+
+// changeIssueState moves an issue to a new state and records the change in its history.
+// The update is guarded by the old state, so concurrent changes are not recorded twice.
+func (a *Analyzer) changeIssueState(ctx context.Context, change models.FileIssueChange) (bool, error) {
+        tx, err := a.db.Begin(ctx)
+        if err != nil {
+                return false, err
+        }
+        defer tx.Rollback(ctx)
+
+        tag, err := tx.Exec(ctx,
+                `UPDATE file_issues SET state = $1
+                 WHERE id = $2 AND project_uuid = $3 AND state = $4`,
+                change.NewState, change.IssueID, change.ProjectUUID, change.OldState)
+        if err != nil {
+                return false, err
+        }
+        if tag.RowsAffected() == 0 {
+                return false, nil
+        }
+
+        _, err = tx.Exec(ctx,
+                `INSERT INTO file_issue_history (issue_id, project_uuid, old_state, new_state, reason, supporting_issue_ids)
+                 VALUES ($1, $2, $3, $4, $5, $6)`,
+                change.IssueID, change.ProjectUUID, change.OldState, change.NewState, change.Reason, change.SupportingIssueIDs)
+        if err != nil {
+                return false, err
+        }
+
+        return true, tx.Commit(ctx)
+}
+
+// GetFileIssueHistory returns all recorded issue state changes of the project in order
+func (a *Analyzer) GetFileIssueHistory(ctx context.Context, projectUUID uuid.UUID) ([]models.FileIssueChange, error) {
+        query := `
+                SELECT id, issue_id, project_uuid, old_state, new_state, reason, supporting_issue_ids, created_at
+                FROM file_issue_history
+                WHERE project_uuid = $1
+                ORDER BY created_at, id`
+
+        rows, err := a.db.Query(ctx, query, projectUUID)
+        if err != nil {
+                return nil, err
+        }
+        defer rows.Close()
+
+        history := []models.FileIssueChange{}
+        for rows.Next() {
+                var change models.FileIssueChange
+                err := rows.Scan(&change.ID, &change.IssueID, &change.ProjectUUID, &change.OldState,
+                        &change.NewState, &change.Reason, &change.SupportingIssueIDs, &change.CreatedAt)
+                if err != nil {
+                        return nil, err
+                }
+                history = append(history, change)
+        }
+
+        return history, rows.Err()
+}
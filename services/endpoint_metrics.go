@@ -0,0 +1,213 @@
+package services
+
+import (
+        "context"
+        "encoding/json"
+        "fmt"
+        "sort"
+        "strings"
+
+        "github.com/performance-analyzer/models"
+)
+
+var httpMethods = map[string]bool{
+        "GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true,
+        "HEAD": true, "OPTIONS": true, "CONNECT": true, "TRACE": true,
+}
+
+// NormalizeEndpointMetrics validates the per-endpoint metrics of the request.
+// Clients that still send only the response_time_p95/p99 maps get endpoints derived
+// from them, and clients that send only endpoints get the legacy maps filled in.
+func NormalizeEndpointMetrics(req *models.SendResultsRequest) error {
+        if len(req.Endpoints) == 0 {
+                req.Endpoints = endpointsFromLegacy(req.ResponseTimeP95, req.ResponseTimeP99)
+        }
+
+        seen := make(map[string]bool)
+        for i := range req.Endpoints {
+                endpoint := &req.Endpoints[i]
+                endpoint.Name = strings.TrimSpace(endpoint.Name)
+                endpoint.Method = strings.ToUpper(strings.TrimSpace(endpoint.Method))
+                if endpoint.PercentilesSource == "" {
+                        endpoint.PercentilesSource = models.PercentilesReported
+                }
+
+                if endpoint.Name == "" {
+                        return fmt.Errorf("endpoint #%d: name is required", i+1)
+                }
+                if len(endpoint.Name) > 500 {
+                        return fmt.Errorf("endpoint %q: name is too long", endpoint.Name)
+                }
+                if endpoint.Method != "" && !httpMethods[endpoint.Method] {
+                        return fmt.Errorf("endpoint %q: unknown method %q", endpoint.Name, endpoint.Method)
+                }
+
+                label := EndpointLabel(*endpoint)
+                if seen[label] {
+                        return fmt.Errorf("endpoint %q is listed twice", label)
+                }
+                seen[label] = true
+
+                if err := validatePercentiles(*endpoint); err != nil {
+                        return fmt.Errorf("endpoint %q: %w", label, err)
+                }
+                if endpoint.RPS != nil && *endpoint.RPS < 0 {
+                        return fmt.Errorf("endpoint %q: rps cannot be negative", label)
+                }
+                if endpoint.Requests < 0 || endpoint.Errors < 0 {
+                        return fmt.Errorf("endpoint %q: request counts cannot be negative", label)
+                }
+                if endpoint.Errors > endpoint.Requests {
+                        return fmt.Errorf("endpoint %q: errors cannot exceed requests", label)
+                }
+                for code, count := range endpoint.ErrorCounts {
+                        if count < 0 {
+                                return fmt.Errorf("endpoint %q: error count for %q cannot be negative", label, code)
+                        }
+                }
+        }
+
+        if len(req.ResponseTimeP95) == 0 || string(req.ResponseTimeP95) == "null" {
+                req.ResponseTimeP95 = legacyPercentiles(req.Endpoints, func(e models.EndpointMetrics) *float64 { return e.P95 })
+        }
+        if len(req.ResponseTimeP99) == 0 || string(req.ResponseTimeP99) == "null" {
+                req.ResponseTimeP99 = legacyPercentiles(req.Endpoints, func(e models.EndpointMetrics) *float64 { return e.P99 })
+        }
+
+        return nil
+}
+
+// EndpointLabel renders an endpoint as "GET /items", or just its name when the method is unknown
+func EndpointLabel(endpoint models.EndpointMetrics) string {
+        if endpoint.Method == "" {
+                return endpoint.Name
+        }
+        return endpoint.Method + " " + endpoint.Name
+}
+
+// validatePercentiles checks that percentiles are non-negative and do not decrease
+func validatePercentiles(endpoint models.EndpointMetrics) error {
+        ordered := []struct {
+                name  string
+                value *float64
+        }{
+                {"p50", endpoint.P50}, {"p90", endpoint.P90}, {"p95", endpoint.P95},
+                {"p99", endpoint.P99}, {"max", endpoint.Max},
+        }
+
+        prevName := ""
+        var prev *float64
+        for _, p := range ordered {
+                if p.value == nil {
+                        continue
+                }
+                if *p.value < 0 {
+                        return fmt.Errorf("%s cannot be negative", p.name)
+                }
+                if prev != nil && *p.value < *prev {
+                        return fmt.Errorf("%s (%g) is lower than %s (%g)", p.name, *p.value, prevName, *prev)
+                }
+                prev, prevName = p.value, p.name
+        }
+        return nil
+}
+
+// endpointsFromLegacy builds endpoints from maps like {"GET_api_v1_products": 1200}.
+// Maps with any nested or non-numeric value cannot be interpreted and yield no endpoints
+// rather than a partial list; the final analysis then passes the maps to the model as sent.
+func endpointsFromLegacy(p95, p99 json.RawMessage) []models.EndpointMetrics {
+        var p95Values, p99Values map[string]float64
+        if len(p95) > 0 && json.Unmarshal(p95, &p95Values) != nil {
+                return nil
+        }
+        if len(p99) > 0 && json.Unmarshal(p99, &p99Values) != nil {
+                return nil
+        }
+
+        keys := make(map[string]bool)
+        for key := range p95Values {
+                keys[key] = true
+        }
+        for key := range p99Values {
+                keys[key] = true
+        }
+
+        endpoints := make([]models.EndpointMetrics, 0, len(keys))
+        for key := range keys {
+                method, name := splitEndpointKey(key)
+                endpoint := models.EndpointMetrics{Name: name, Method: method}
+                if value, ok := p95Values[key]; ok {
+                        v := value
+                        endpoint.P95 = &v
+                }
+                if value, ok := p99Values[key]; ok {
+                        v := value
+                        endpoint.P99 = &v
+                }
+                endpoints = append(endpoints, endpoint)
+        }
+
+        sort.Slice(endpoints, func(i, j int) bool {
+                return EndpointLabel(endpoints[i]) < EndpointLabel(endpoints[j])
+        })
+        return endpoints
+}
+
+// splitEndpointKey splits "GET /items" or "GET_api_items" into method and name
+func splitEndpointKey(key string) (string, string) {
+        key = strings.TrimSpace(key)
+        for _, sep := range []string{" ", "_"} {
+                if i := strings.Index(key, sep); i > 0 {
+                        method := strings.ToUpper(key[:i])
+                        if httpMethods[method] && i+1 < len(key) {
+                                return method, key[i+1:]
+                        }
+                }
+        }
+        return "", key
+}
+
+func legacyPercentiles(endpoints []models.EndpointMetrics, value func(models.EndpointMetrics) *float64) json.RawMessage {
+        values := make(map[string]float64)
+        for _, endpoint := range endpoints {
+                if v := value(endpoint); v != nil {
+                        values[EndpointLabel(endpoint)] = *v
+                }
+        }
+        if len(values) == 0 {
+                return nil
+        }
+        data, _ := json.Marshal(values)
+        return data
+}
+
+// GetEndpointMetrics returns the per-endpoint metrics stored with a test result
+func (a *Analyzer) GetEndpointMetrics(ctx context.Context, testResultID int) ([]models.EndpointMetrics, error) {
+        query := `
+                SELECT id, test_result_id, name, method, p50, p90, p95, p99, max, rps, requests, errors, error_counts,
+                       percentiles_source, latency_histogram
+                FROM endpoint_metrics
+                WHERE test_result_id = $1
+                ORDER BY name, method`
+
+        rows, err := a.db.Query(ctx, query, testResultID)
+        if err != nil {
+                return nil, err
+        }
+        defer rows.Close()
+
+        endpoints := []models.EndpointMetrics{}
+        for rows.Next() {
+                var endpoint models.EndpointMetrics
+                err := rows.Scan(&endpoint.ID, &endpoint.TestResultID, &endpoint.Name, &endpoint.Method,
+                        &endpoint.P50, &endpoint.P90, &endpoint.P95, &endpoint.P99, &endpoint.Max, &endpoint.RPS,
+                        &endpoint.Requests, &endpoint.Errors, &endpoint.ErrorCounts,
+                        &endpoint.PercentilesSource, &endpoint.Histogram)
+                if err != nil {
+                        return nil, err
+                }
+                endpoints = append(endpoints, endpoint)
+        }
+
+        return endpoints, rows.Err()
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+        "context"
+        "encoding/json"
+        "errors"
+        "fmt"
+        "log"
+        "time"
+
+        "github.com/google/uuid"
+        "github.com/jackc/pgx/v5"
+        "github.com/performance-analyzer/models"
+)
+
+// TriggerFileAnalysis queues the AI review of an uploaded file in the job queue
+func (a *Analyzer) TriggerFileAnalysis(ctx context.Context, projectUUID uuid.UUID, fileID int) error {
+        if err := a.jobs.EnqueueFile(ctx, models.JobKindFileAnalysis, projectUUID, fileID); err != nil {
+                return err
+        }
+        log.Printf("Queued analysis of file %d for project %s", fileID, projectUUID)
+        return nil
+}
+
+// TriggerFinalAnalysisIfReady queues the final analysis once every file is received and
+// analysed and the test results are in. The project moves from collecting to ready at the
+// same time, so of the callers that find it complete only one queues the analysis. It
+// reports whether this call queued it.
+func (a *Analyzer) TriggerFinalAnalysisIfReady(ctx context.Context, projectUUID uuid.UUID) (bool, error) {
+        ready, err := a.markProjectReady(ctx, projectUUID)
+        if err != nil || !ready {
+                return false, err
+        }
+        return true, a.TriggerFinalAnalysis(ctx, projectUUID)
+}
+
+// processFileAnalysis asks the AI model to review one uploaded file and stores the analysis
+// with the issues found, then queues the final analysis if this was the last file
+func (a *Analyzer) processFileAnalysis(ctx context.Context, projectUUID uuid.UUID, fileID int) error {
+        var filename, content string
+        err := a.db.QueryRow(ctx,
+                `UPDATE project_files f SET analysis_status = 'analyzing'
+                 FROM projects p
+                 WHERE f.id = $1 AND p.uuid = f.project_uuid AND p.status = 'collecting'
+                 RETURNING f.filename, f.content`, fileID).Scan(&filename, &content)
+        if errors.Is(err, pgx.ErrNoRows) {
+                log.Printf("Skipping analysis of file %d: project %s no longer collects files", fileID, projectUUID)
+                return nil
+        } else if err != nil {
+                return fmt.Errorf("failed to start analysis of file %d: %w", fileID, err)
+        }
+
+        project, err := a.GetProject(ctx, projectUUID)
+        if err != nil {
+                return fmt.Errorf("failed to get project: %w", err)
+        }
+
+        var fileAnalysis json.RawMessage
+        var fileIssues []models.FileIssue
+        err = a.runStage(ctx, projectUUID, models.AnalysisStageFile, func() (err error) {
+                fileAnalysis, fileIssues, err = a.AnalyzeFile(ctx, project, filename, content)
+                if err != nil {
+                        return fmt.Errorf("%s: %w", filename, err)
+                }
+                return nil
+        })
+        if err != nil {
+                return err
+        }
+
+        saved, err := a.saveFileAnalysis(ctx, projectUUID, fileID, filename, content, fileAnalysis, fileIssues)
+        if err != nil {
+                return fmt.Errorf("failed to save analysis of %s: %w", filename, err)
+        }
+        if !saved {
+                log.Printf("File %s of project %s was uploaded again during its analysis, result discarded", filename, projectUUID)
+                return nil
+        }
+        log.Printf("Analysis of file %s for project %s completed with %d issues", filename, projectUUID, len(fileIssues))
+
+        if _, err := a.TriggerFinalAnalysisIfReady(ctx, projectUUID); err != nil {
+                return err
+        }
+        return nil
+}
+
+// saveFileAnalysis replaces the analysis and the issues of a file. Nothing is saved when the
+// file was uploaded again meanwhile, as the queued analysis of the new version will.
+func (a *Analyzer) saveFileAnalysis(ctx context.Context, projectUUID uuid.UUID, fileID int, filename, content string,
+        fileAnalysis json.RawMessage, fileIssues []models.FileIssue) (bool, error) {
+        tx, err := a.db.Begin(ctx)
+        if err != nil {
+                return false, err
+        }
+        defer tx.Rollback(ctx)
+
+        tag, err := tx.Exec(ctx,
+                `UPDATE project_files
+                 SET file_analysis = $1, analysis_status = 'done', analysis_error = NULL
+                 WHERE id = $2 AND content = $3 AND analysis_status = 'analyzing'`,
+                fileAnalysis, fileID, content)
+        if err != nil {
+                return false, err
+        }
+        if tag.RowsAffected() == 0 {
+                return false, nil
+        }
+
+        // Replace issues found in the previous version of the file
+        if _, err := tx.Exec(ctx, "DELETE FROM file_issues WHERE file_id = $1", fileID); err != nil {
+                return false, err
+        }
+
+        issueQuery := `
+                INSERT INTO file_issues (project_uuid, file_id, filename, name, description, recommendation,
+                                         line_start, line_end, column_start, column_end, severity, state)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+        for _, issue := range fileIssues {
+                _, err = tx.Exec(ctx, issueQuery,
+                        projectUUID, fileID, filename, issue.Name, issue.Description, issue.Recommendation,
+                        issue.LineStart, issue.LineEnd, issue.ColumnStart, issue.ColumnEnd, issue.Severity, issue.State)
+                if err != nil {
+                        return false, err
+                }
+        }
+
+        return true, tx.Commit(ctx)
+}
+
+// markFileAnalysisRetrying puts a file whose analysis failed with a transient error back to
+// queued until its job is retried
+func (a *Analyzer) markFileAnalysisRetrying(ctx context.Context, fileID int, errorMsg string) {
+        _, err := a.db.Exec(ctx,
+                `UPDATE project_files SET analysis_status = 'queued', analysis_error = $1 WHERE id = $2`,
+                errorMsg, fileID)
+        if err != nil {
+                log.Printf("Failed to mark analysis of file %d as retrying: %v", fileID, err)
+        }
+}
+
+// markFileAnalysisFailed stores the error in place of the file analysis. A failed file does
+// not hold the project back: the final analysis goes ahead without its issues.
+func (a *Analyzer) markFileAnalysisFailed(ctx context.Context, projectUUID uuid.UUID, fileID int, errorMsg string) {
+        errorAnalysis, _ := json.Marshal(map[string]interface{}{
+                "error":       "AI analysis failed",
+                "message":     errorMsg,
+                "analyzed_at": time.Now(),
+        })
+        _, err := a.db.Exec(ctx,
+                `UPDATE project_files
+                 SET analysis_status = 'failed', analysis_error = $1, file_analysis = $2
+                 WHERE id = $3`,
+                errorMsg, errorAnalysis, fileID)
+        if err != nil {
+                log.Printf("Failed to mark analysis of file %d as failed: %v", fileID, err)
+                return
+        }
+
+        if _, err := a.TriggerFinalAnalysisIfReady(ctx, projectUUID); err != nil {
+                log.Printf("Failed to queue final analysis for %s: %v", projectUUID, err)
+        }
+}
+
+// GetFileStatuses returns the analysis progress of every uploaded file of the project
+func (a *Analyzer) GetFileStatuses(ctx context.Context, projectUUID uuid.UUID) ([]models.FileAnalysisStatus, error) {
+        rows, err := a.db.Query(ctx,
+                `SELECT id, filename, analysis_status, analysis_error
+                 FROM project_files WHERE project_uuid = $1
+                 ORDER BY filename`, projectUUID)
+        if err != nil {
+                return nil, err
+        }
+        defer rows.Close()
+
+        statuses := []models.FileAnalysisStatus{}
+        for rows.Next() {
+                var status models.FileAnalysisStatus
+                if err := rows.Scan(&status.FileID, &status.Filename, &status.AnalysisStatus, &status.AnalysisError); err != nil {
+                        return nil, err
+                }
+                statuses = append(statuses, status)
+        }
+        return statuses, rows.Err()
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+        "context"
+        "fmt"
+        "strings"
+
+        "github.com/google/uuid"
+        "github.com/performance-analyzer/models"
+)
+
+// aiFileIssue is a single issue as returned by the model for a code file
+type aiFileIssue struct {
+        Name           string `json:"name"`
+        Description    string `json:"description"`
+        Recommendation string `json:"recommendation"`
+        Location       struct {
+                LineStart   *int `json:"line_start"`
+                LineEnd     *int `json:"line_end"`
+                ColumnStart *int `json:"column_start"`
+                ColumnEnd   *int `json:"column_end"`
+        } `json:"location"`
+        Severity string `json:"severity"`
+        Doubtful *bool  `json:"doubtful"`
+}
+
+// parseFileIssues converts the model's file analysis JSON into file issues.
+// Issues without an explicit doubtful flag are stored as suspicions.
+func parseFileIssues(content string) ([]models.FileIssue, error) {
+        var parsed struct {
+                Issues []aiFileIssue `json:"issues"`
+        }
+        if err := parseJSONContent(content, &parsed); err != nil {
+                return nil, err
+        }
+
+        issues := make([]models.FileIssue, 0, len(parsed.Issues))
+        for _, item := range parsed.Issues {
+                if strings.TrimSpace(item.Name) == "" {
+                        continue
+                }
+
+                state := models.IssueStateSuspicion
+                if item.Doubtful != nil && !*item.Doubtful {
+                        state = models.IssueStateConfirmed
+                }
+
+                issue := models.FileIssue{
+                        Name:           item.Name,
+                        Description:    item.Description,
+                        Recommendation: item.Recommendation,
+                        LineStart:      item.Location.LineStart,
+                        LineEnd:        item.Location.LineEnd,
+                        ColumnStart:    item.Location.ColumnStart,
+                        ColumnEnd:      item.Location.ColumnEnd,
+                        Severity:       normalizeSeverity(item.Severity),
+                        State:          state,
+                }
+                if issue.LineEnd == nil {
+                        issue.LineEnd = issue.LineStart
+                }
+                issues = append(issues, issue)
+        }
+
+        return issues, nil
+}
+
+// ParseFileIssueFilter builds a filter from comma-separated severity and state lists
+func ParseFileIssueFilter(severities, states string) (models.FileIssueFilter, error) {
+        var filter models.FileIssueFilter
+
+        for _, severity := range splitList(severities) {
+                switch severity {
+                case models.SeverityLow, models.SeverityMedium, models.SeverityHigh, models.SeverityCritical:
+                        filter.Severities = append(filter.Severities, severity)
+                default:
+                        return filter, fmt.Errorf("unknown severity %q", severity)
+                }
+        }
+
+        for _, state := range splitList(states) {
+                switch state {
+                case models.IssueStateSuspicion, models.IssueStateConfirmed:
+                        filter.States = append(filter.States, state)
+                default:
+                        return filter, fmt.Errorf("unknown state %q", state)
+                }
+        }
+
+        return filter, nil
+}
+
+// GetFileIssues returns the project's file issues matching the filter, most severe first
+func (a *Analyzer) GetFileIssues(ctx context.Context, projectUUID uuid.UUID, filter models.FileIssueFilter) ([]models.FileIssue, error) {
+        query := `
+                SELECT id, project_uuid, file_id, filename, name, description, recommendation,
+                       line_start, line_end, column_start, column_end, severity, state, created_at, updated_at
+                FROM file_issues
+                WHERE project_uuid = $1
+                  AND (cardinality($2::text[]) = 0 OR severity = ANY($2))
+                  AND (cardinality($3::text[]) = 0 OR state = ANY($3))
+                ORDER BY CASE severity
+                             WHEN 'critical' THEN 1
+                             WHEN 'high' THEN 2
+                             WHEN 'medium' THEN 3
+                             ELSE 4
+                         END, filename, line_start NULLS LAST, id`
+
+        severities := filter.Severities
+        if severities == nil {
+                severities = []string{}
+        }
+        states := filter.States
+        if states == nil {
+                states = []string{}
+        }
+
+        rows, err := a.db.Query(ctx, query, projectUUID, severities, states)
+        if err != nil {
+                return nil, err
+        }
+        defer rows.Close()
+
+        issues := []models.FileIssue{}
+        for rows.Next() {
+                var issue models.FileIssue
+                var description, recommendation *string
+                err := rows.Scan(&issue.ID, &issue.ProjectUUID, &issue.FileID, &issue.Filename,
+                        &issue.Name, &description, &recommendation,
+                        &issue.LineStart, &issue.LineEnd, &issue.ColumnStart, &issue.ColumnEnd,
+                        &issue.Severity, &issue.State, &issue.CreatedAt, &issue.UpdatedAt)
+                if err != nil {
+                        return nil, err
+                }
+                if description != nil {
+                        issue.Description = *description
+                }
+                if recommendation != nil {
+                        issue.Recommendation = *recommendation
+                }
+                issues = append(issues, issue)
+        }
+
+        return issues, rows.Err()
+}
+
+// summarizeFileIssues counts issues by severity and by state
+func summarizeFileIssues(issues []models.FileIssue) map[string]interface{} {
+        bySeverity := map[string]int{
+                models.SeverityCritical: 0,
+                models.SeverityHigh:     0,
+                models.SeverityMedium:   0,
+                models.SeverityLow:      0,
+        }
+        byState := map[string]int{
+                models.IssueStateSuspicion: 0,
+                models.IssueStateConfirmed: 0,
+        }
+        for _, issue := range issues {
+                bySeverity[issue.Severity]++
+                byState[issue.State]++
+        }
+
+        return map[string]interface{}{
+                "total":       len(issues),
+                "by_severity": bySeverity,
+                "by_state":    byState,
+        }
+}
+
+func splitList(value string) []string {
+        var items []string
+        for _, item := range strings.Split(value, ",") {
+                item = strings.ToLower(strings.TrimSpace(item))
+                if item != "" {
+                        items = append(items, item)
+                }
+        }
+        return items
+}
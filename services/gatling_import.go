@@ -0,0 +1,228 @@
+package services
+
+import (
+        "bufio"
+        "bytes"
+        "encoding/json"
+        "fmt"
+        "io"
+        "sort"
+        "strconv"
+        "strings"
+        "time"
+
+        "github.com/performance-analyzer/models"
+)
+
+func init() {
+        RegisterResultsParser("gatling", ResultsParserFunc(ParseGatlingResults))
+}
+
+// gatlingNumber is a stats.json value; Gatling writes numbers, numeric strings or "-" when there is no data
+type gatlingNumber struct {
+        value *float64
+}
+
+func (n *gatlingNumber) UnmarshalJSON(data []byte) error {
+        var number float64
+        if json.Unmarshal(data, &number) == nil {
+                n.value = &number
+                return nil
+        }
+        var text string
+        if json.Unmarshal(data, &text) == nil {
+                if number, err := strconv.ParseFloat(text, 64); err == nil {
+                        n.value = &number
+                }
+        }
+        return nil
+}
+
+// gatlingTriple holds a stat for all, successful and failed requests
+type gatlingTriple struct {
+        Total gatlingNumber `json:"total"`
+        OK    gatlingNumber `json:"ok"`
+        KO    gatlingNumber `json:"ko"`
+}
+
+// gatlingStats is the stats block of a stats.json node. With the default gatling.conf
+// percentiles1-4 are the 50th, 75th, 95th and 99th percentiles.
+type gatlingStats struct {
+        NumberOfRequests              gatlingTriple `json:"numberOfRequests"`
+        MaxResponseTime               gatlingTriple `json:"maxResponseTime"`
+        Percentiles1                  gatlingTriple `json:"percentiles1"`
+        Percentiles3                  gatlingTriple `json:"percentiles3"`
+        Percentiles4                  gatlingTriple `json:"percentiles4"`
+        MeanNumberOfRequestsPerSecond gatlingTriple `json:"meanNumberOfRequestsPerSecond"`
+}
+
+// gatlingNode is a GROUP or REQUEST node of js/stats.json
+type gatlingNode struct {
+        Type     string                 `json:"type"`
+        Name     string                 `json:"name"`
+        Path     string                 `json:"path"`
+        Stats    gatlingStats           `json:"stats"`
+        Contents map[string]gatlingNode `json:"contents"`
+}
+
+// ParseGatlingResults reads a Gatling report: js/stats.json from the HTML report
+// or the text simulation.log the report is generated from
+func ParseGatlingResults(r io.Reader, project *models.Project) (*models.SendResultsRequest, error) {
+        reader := bufio.NewReaderSize(r, 64*1024)
+        head, _ := reader.Peek(512)
+        if bytes.IndexByte(head, 0) != -1 {
+                return nil, fmt.Errorf("binary simulation.log (Gatling 3.10+) is not supported, upload js/stats.json instead")
+        }
+
+        var req *models.SendResultsRequest
+        var err error
+        source := "simulation.log"
+        if trimmed := bytes.TrimSpace(head); len(trimmed) > 0 && trimmed[0] == '{' {
+                source = "stats.json"
+                req, err = parseGatlingStats(reader)
+        } else {
+                req, err = parseGatlingLog(reader)
+        }
+        if err != nil {
+                return nil, err
+        }
+
+        raw := map[string]interface{}{
+                "source":     "gatling",
+                "report":     source,
+                "assertions": evaluateImportedNFRs(project, req),
+        }
+        req.RawResults, _ = json.Marshal(raw)
+
+        return req, nil
+}
+
+func parseGatlingStats(r io.Reader) (*models.SendResultsRequest, error) {
+        var root gatlingNode
+        if err := json.NewDecoder(r).Decode(&root); err != nil {
+                return nil, fmt.Errorf("invalid stats.json: %w", err)
+        }
+
+        total := gatlingCount(root.Stats.NumberOfRequests.Total)
+        if total == 0 {
+                return nil, fmt.Errorf("stats.json has no requests")
+        }
+
+        req := &models.SendResultsRequest{
+                SuccessfulCalls: gatlingCount(root.Stats.NumberOfRequests.OK),
+                FailedCalls:     gatlingCount(root.Stats.NumberOfRequests.KO),
+        }
+        if rps := root.Stats.MeanNumberOfRequestsPerSecond.Total.value; rps != nil && *rps > 0 {
+                req.AchievedRPS = rps
+                // Gatling computes the mean rate over the whole run, so the run length follows from it
+                req.TestDuration, _ = json.Marshal(float64(total) / *rps)
+        }
+
+        collectGatlingRequests(root, &req.Endpoints)
+        sort.Slice(req.Endpoints, func(i, j int) bool {
+                return EndpointLabel(req.Endpoints[i]) < EndpointLabel(req.Endpoints[j])
+        })
+
+        return req, nil
+}
+
+func collectGatlingRequests(node gatlingNode, endpoints *[]models.EndpointMetrics) {
+        if node.Type == "REQUEST" {
+                name := node.Path
+                if name == "" {
+                        name = node.Name
+                }
+                method, name := splitEndpointKey(name)
+                stats := node.Stats
+                *endpoints = append(*endpoints, models.EndpointMetrics{
+                        Name:     name,
+                        Method:   method,
+                        P50:      stats.Percentiles1.Total.value,
+                        P95:      stats.Percentiles3.Total.value,
+                        P99:      stats.Percentiles4.Total.value,
+                        Max:      stats.MaxResponseTime.Total.value,
+                        RPS:      stats.MeanNumberOfRequestsPerSecond.Total.value,
+                        Requests: gatlingCount(stats.NumberOfRequests.Total),
+                        Errors:   gatlingCount(stats.NumberOfRequests.KO),
+                })
+        }
+
+        for _, child := range node.Contents {
+                collectGatlingRequests(child, endpoints)
+        }
+}
+
+func gatlingCount(n gatlingNumber) int {
+        if n.value == nil {
+                return 0
+        }
+        return int(*n.value)
+}
+
+// parseGatlingLog aggregates REQUEST records of a text simulation.log. Depending on the
+// Gatling version a record is "REQUEST <groups> <name> <start> <end> <OK|KO> <message>"
+// or carries the user id before the groups, so fields are located from the status backwards.
+func parseGatlingLog(r io.Reader) (*models.SendResultsRequest, error) {
+        aggregator := newSampleAggregator()
+
+        scanner := bufio.NewScanner(r)
+        scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+        for scanner.Scan() {
+                line := scanner.Text()
+                if !strings.HasPrefix(line, "REQUEST\t") {
+                        continue
+                }
+
+                fields := strings.Split(line, "\t")
+                status := -1
+                for i := len(fields) - 1; i >= 4; i-- {
+                        if fields[i] == "OK" || fields[i] == "KO" {
+                                status = i
+                                break
+                        }
+                }
+                if status == -1 {
+                        continue
+                }
+
+                start, err1 := strconv.ParseInt(fields[status-2], 10, 64)
+                end, err2 := strconv.ParseInt(fields[status-1], 10, 64)
+                if err1 != nil || err2 != nil {
+                        continue
+                }
+
+                name := fields[status-3]
+                if groups := fields[status-4]; status-4 >= 1 && groups != "" && !isInteger(groups) {
+                        name = strings.ReplaceAll(groups, ",", " / ") + " / " + name
+                }
+
+                message := ""
+                if status+1 < len(fields) {
+                        message = truncateErrorCode(fields[status+1])
+                }
+                aggregator.Add(name, time.UnixMilli(start), time.Duration(end-start)*time.Millisecond, fields[status] == "OK", message)
+        }
+        if err := scanner.Err(); err != nil {
+                return nil, fmt.Errorf("failed to read simulation.log: %w", err)
+        }
+
+        req := aggregator.Result()
+        if req.SuccessfulCalls+req.FailedCalls == 0 {
+                return nil, fmt.Errorf("simulation.log has no REQUEST records")
+        }
+        return req, nil
+}
+
+func isInteger(s string) bool {
+        _, err := strconv.ParseInt(s, 10, 64)
+        return err == nil
+}
+
+// truncateErrorCode keeps error messages usable as error_counts keys
+func truncateErrorCode(message string) string {
+        message = strings.TrimSpace(message)
+        if len(message) > 200 {
+                message = message[:200]
+        }
+        return message
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+        "math"
+        "math/bits"
+        "sort"
+        "time"
+
+        "github.com/performance-analyzer/models"
+)
+
+const (
+        // hdrSignificantDigits is the precision every recorded value keeps
+        hdrSignificantDigits = 3
+        // hdrSubBucketBits gives 2048 sub-buckets, the smallest power of two above 2*10^3
+        hdrSubBucketBits  = 11
+        hdrSubBucketCount = 1 << hdrSubBucketBits
+        hdrSubBucketHalf  = hdrSubBucketCount / 2
+        // hdrHighestTrackable caps recorded latencies at one hour
+        hdrHighestTrackable = int64(time.Hour / time.Microsecond)
+)
+
+// hdrHistogram is a High Dynamic Range histogram of latencies in microseconds.
+// Values below 2048µs are counted exactly; above that every power-of-two range is split
+// into 1024 linear sub-buckets, so any value is recorded within 0.1% relative error.
+// Counts are kept sparse, so memory depends on the spread of latencies, not on the sample count.
+type hdrHistogram struct {
+        counts map[int32]int64
+        total  int64
+        min    int64
+        max    int64
+}
+
+func newHDRHistogram() *hdrHistogram {
+        return &hdrHistogram{counts: make(map[int32]int64)}
+}
+
+// hdrIndex maps a value to its bucket
+func hdrIndex(value int64) int32 {
+        if value < hdrSubBucketCount {
+                return int32(value)
+        }
+        exponent := bits.Len64(uint64(value)) - hdrSubBucketBits
+        sub := value >> exponent
+        return int32(hdrSubBucketCount + (exponent-1)*hdrSubBucketHalf + int(sub-hdrSubBucketHalf))
+}
+
+// hdrBucketRange returns the lowest and highest values that share a bucket
+func hdrBucketRange(index int32) (int64, int64) {
+        if index < hdrSubBucketCount {
+                return int64(index), int64(index)
+        }
+        offset := int64(index) - hdrSubBucketCount
+        exponent := offset/hdrSubBucketHalf + 1
+        sub := offset%hdrSubBucketHalf + hdrSubBucketHalf
+        return sub << exponent, (sub+1)<<exponent - 1
+}
+
+// Record adds a latency in microseconds; values above one hour are recorded as one hour
+func (h *hdrHistogram) Record(micros int64) {
+        if micros < 0 {
+                micros = 0
+        }
+        if micros > hdrHighestTrackable {
+                micros = hdrHighestTrackable
+        }
+
+        h.counts[hdrIndex(micros)]++
+        if h.total == 0 || micros < h.min {
+                h.min = micros
+        }
+        if micros > h.max {
+                h.max = micros
+        }
+        h.total++
+}
+
+// RecordDuration adds a latency
+func (h *hdrHistogram) RecordDuration(d time.Duration) {
+        h.Record(int64(d / time.Microsecond))
+}
+
+// sortedIndexes returns the non-empty buckets in value order
+func (h *hdrHistogram) sortedIndexes() []int32 {
+        indexes := make([]int32, 0, len(h.counts))
+        for index := range h.counts {
+                indexes = append(indexes, index)
+        }
+        sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+        return indexes
+}
+
+// ValueAtPercentile returns the value below or at which p percent of the samples fall,
+// as the highest value equivalent to the bucket holding that rank
+func (h *hdrHistogram) ValueAtPercentile(p float64) int64 {
+        if h.total == 0 {
+                return 0
+        }
+        rank := int64(p / 100 * float64(h.total))
+        if float64(rank) < p/100*float64(h.total) {
+                rank++
+        }
+        if rank < 1 {
+                rank = 1
+        }
+
+        var seen int64
+        for _, index := range h.sortedIndexes() {
+                seen += h.counts[index]
+                if seen >= rank {
+                        _, highest := hdrBucketRange(index)
+                        if highest > h.max {
+                                highest = h.max
+                        }
+                        return highest
+                }
+        }
+        return h.max
+}
+
+// Fill sets the percentiles (in milliseconds) and the histogram of the endpoint
+func (h *hdrHistogram) Fill(endpoint *models.EndpointMetrics) {
+        if h.total == 0 {
+                return
+        }
+        ms := func(micros int64) *float64 {
+                value := float64(micros) / 1000
+                return &value
+        }
+        endpoint.P50 = ms(h.ValueAtPercentile(50))
+        endpoint.P90 = ms(h.ValueAtPercentile(90))
+        endpoint.P95 = ms(h.ValueAtPercentile(95))
+        endpoint.P99 = ms(h.ValueAtPercentile(99))
+        endpoint.Max = ms(h.max)
+        endpoint.PercentilesSource = models.PercentilesComputed
+        endpoint.Histogram = h.Export()
+}
+
+// Export serializes the histogram for storage
+func (h *hdrHistogram) Export() *models.LatencyHistogram {
+        exported := &models.LatencyHistogram{
+                SignificantDigits: hdrSignificantDigits,
+                TotalCount:        h.total,
+                MinMicros:         h.min,
+                MaxMicros:         h.max,
+                Buckets:           make([][2]int64, 0, len(h.counts)),
+        }
+        for _, index := range h.sortedIndexes() {
+                lowest, _ := hdrBucketRange(index)
+                exported.Buckets = append(exported.Buckets, [2]int64{lowest, h.counts[index]})
+        }
+        return exported
+}
+
+// kolmogorovSmirnov runs the two-sample Kolmogorov-Smirnov test on two exported histograms
+// of the same bucket layout. It returns the largest distance between their cumulative
+// distributions and the asymptotic p-value of the samples coming from one distribution.
+func kolmogorovSmirnov(a, b *models.LatencyHistogram) (float64, float64) {
+        if a == nil || b == nil || a.TotalCount == 0 || b.TotalCount == 0 {
+                return 0, 1
+        }
+
+        var seenA, seenB int64
+        var distance float64
+        i, j := 0, 0
+        for i < len(a.Buckets) || j < len(b.Buckets) {
+                // Step to the next bucket boundary present in either histogram
+                value := int64(math.MaxInt64)
+                if i < len(a.Buckets) {
+                        value = a.Buckets[i][0]
+                }
+                if j < len(b.Buckets) && b.Buckets[j][0] < value {
+                        value = b.Buckets[j][0]
+                }
+                for i < len(a.Buckets) && a.Buckets[i][0] == value {
+                        seenA += a.Buckets[i][1]
+                        i++
+                }
+                for j < len(b.Buckets) && b.Buckets[j][0] == value {
+                        seenB += b.Buckets[j][1]
+                        j++
+                }
+                d := math.Abs(float64(seenA)/float64(a.TotalCount) - float64(seenB)/float64(b.TotalCount))
+                if d > distance {
+                        distance = d
+                }
+        }
+
+        n := float64(a.TotalCount) * float64(b.TotalCount) / float64(a.TotalCount+b.TotalCount)
+        lambda := (math.Sqrt(n) + 0.12 + 0.11/math.Sqrt(n)) * distance
+        return distance, kolmogorovQ(lambda)
+}
+
+// kolmogorovQ is the survival function of the Kolmogorov distribution
+func kolmogorovQ(lambda float64) float64 {
+        if lambda < 0.2 {
+                return 1
+        }
+        var sum float64
+        sign := 1.0
+        for k := 1; k <= 100; k++ {
+                term := sign * 2 * math.Exp(-2*float64(k*k)*lambda*lambda)
+                sum += term
+                if math.Abs(term) < 1e-12 {
+                        break
+                }
+                sign = -sign
+        }
+        return math.Max(0, math.Min(1, sum))
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+        "context"
+        "encoding/json"
+        "fmt"
+        "log"
+        "strings"
+        "time"
+
+        "github.com/google/uuid"
+        "github.com/performance-analyzer/models"
+)
+
+// TriggerInputReview queues the asynchronous review of the project's test input parameters
+func (a *Analyzer) TriggerInputReview(ctx context.Context, projectUUID uuid.UUID) error {
+        if err := a.jobs.Enqueue(ctx, models.JobKindInputReview, projectUUID); err != nil {
+                return err
+        }
+        log.Printf("Queued input review for project %s", projectUUID)
+        return nil
+}
+
+// ReviewInputParameters asks the AI model to find problems in the stand, expected load,
+// ramp stages, load profile and NFRs submitted at initAnalize
+func (a *Analyzer) ReviewInputParameters(ctx context.Context, project *models.Project) ([]models.InputIssue, error) {
+        prompt := fmt.Sprintf(`Проанализируйте входные параметры нагрузочного теста как эксперт по тестированию производительности.
+Определите, есть ли проблемы в описании стенда (test или production), ожидаемой нагрузке, параметрах времени подачи нагрузки, ступенях, профиле нагрузки и нефункциональных требованиях.
+Объясните каждую проблему и дайте рекомендации по ее устранению.
+Ответьте в формате JSON: {"issues": [{"name": "имя проблемы", "description": "описание", "recommendation": "рекомендации по устранению", "severity": "low|medium|high|critical"}]}.
+Если проблем нет, верните пустой массив issues.
+
+Язык проекта: %s
+Инструмент тестирования: %s
+Входные параметры тестирования:
+%s`, project.Language, project.TestingTool, string(project.ProjectInfo))
+
+        response, err := a.aiClient.Query(ctx, prompt)
+        if err != nil {
+                return nil, fmt.Errorf("AI input review failed: %w", err)
+        }
+
+        var parsed struct {
+                Issues []models.InputIssue `json:"issues"`
+        }
+        if err := parseJSONContent(response.Content, &parsed); err != nil {
+                return nil, err
+        }
+
+        issues := make([]models.InputIssue, 0, len(parsed.Issues))
+        for _, issue := range parsed.Issues {
+                if strings.TrimSpace(issue.Name) == "" {
+                        continue
+                }
+                issue.Severity = normalizeSeverity(issue.Severity)
+                issues = append(issues, issue)
+        }
+
+        return issues, nil
+}
+
+func (a *Analyzer) processInputReview(ctx context.Context, projectUUID uuid.UUID) error {
+        _, err := a.db.Exec(ctx,
+                "UPDATE input_reviews SET status = 'processing' WHERE project_uuid = $1",
+                projectUUID)
+        if err != nil {
+                return fmt.Errorf("failed to update input review status: %w", err)
+        }
+
+        project, err := a.GetProject(ctx, projectUUID)
+        if err != nil {
+                return fmt.Errorf("failed to get project: %w", err)
+        }
+
+        issues, err := a.ReviewInputParameters(ctx, project)
+        if err != nil {
+                return err
+        }
+
+        issuesJSON, err := json.Marshal(issues)
+        if err != nil {
+                return fmt.Errorf("failed to marshal input issues: %w", err)
+        }
+
+        _, err = a.db.Exec(ctx,
+                `UPDATE input_reviews
+                 SET issues = $1, status = 'completed', error_message = NULL, completed_at = $2
+                 WHERE project_uuid = $3`,
+                issuesJSON, time.Now(), projectUUID)
+        if err != nil {
+                return fmt.Errorf("failed to save input review: %w", err)
+        }
+
+        log.Printf("Input review for project %s completed with %d issues", projectUUID, len(issues))
+        return nil
+}
+
+// markInputReviewRetrying puts a review that failed with a transient error back to pending
+// until its job is retried
+func (a *Analyzer) markInputReviewRetrying(ctx context.Context, projectUUID uuid.UUID, errorMsg string) {
+        _, err := a.db.Exec(ctx,
+                `UPDATE input_reviews
+                 SET status = 'pending', error_message = $1
+                 WHERE project_uuid = $2`,
+                errorMsg, projectUUID)
+        if err != nil {
+                log.Printf("Failed to mark input review as retrying for %s: %v", projectUUID, err)
+        }
+}
+
+func (a *Analyzer) markInputReviewFailed(ctx context.Context, projectUUID uuid.UUID, errorMsg string) {
+        _, err := a.db.Exec(ctx,
+                `UPDATE input_reviews
+                 SET status = 'failed', error_message = $1
+                 WHERE project_uuid = $2`,
+                errorMsg, projectUUID)
+        if err != nil {
+                log.Printf("Failed to mark input review as failed for %s: %v", projectUUID, err)
+        }
+}
+
+// normalizeSeverity maps the severity reported by the model onto the known levels
+func normalizeSeverity(severity string) string {
+        switch strings.ToLower(strings.TrimSpace(severity)) {
+        case models.SeverityCritical, "критическая", "критичная", "blocker":
+                return models.SeverityCritical
+        case models.SeverityHigh, "высокая", "major":
+                return models.SeverityHigh
+        case models.SeverityLow, "низкая", "minor", "info":
+                return models.SeverityLow
+        default:
+                return models.SeverityMedium
+        }
+}
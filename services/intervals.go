@@ -0,0 +1,89 @@
+package services
+
+import (
+        "context"
+        "fmt"
+        "sort"
+
+        "github.com/performance-analyzer/models"
+)
+
+// sampleIntervalSeconds is the bucket width of time series built from raw samples
+const sampleIntervalSeconds = 10
+
+// NormalizeIntervals validates the time-bucketed metrics of the request and sorts them by time.
+// Intervals without rps get it from their request count.
+func NormalizeIntervals(req *models.SendResultsRequest) error {
+        seen := make(map[int64]bool)
+        for i := range req.Intervals {
+                interval := &req.Intervals[i]
+                if interval.Start.IsZero() {
+                        return fmt.Errorf("interval #%d: start is required", i+1)
+                }
+                label := interval.Start.UTC().Format("2006-01-02T15:04:05.000Z")
+                if seen[interval.Start.UnixMilli()] {
+                        return fmt.Errorf("interval %s is listed twice", label)
+                }
+                seen[interval.Start.UnixMilli()] = true
+
+                if interval.DurationSeconds <= 0 {
+                        return fmt.Errorf("interval %s: duration_seconds must be greater than 0", label)
+                }
+                if interval.Requests < 0 || interval.Errors < 0 {
+                        return fmt.Errorf("interval %s: request counts cannot be negative", label)
+                }
+                if interval.Errors > interval.Requests {
+                        return fmt.Errorf("interval %s: errors cannot exceed requests", label)
+                }
+                if interval.RPS != nil && *interval.RPS < 0 {
+                        return fmt.Errorf("interval %s: rps cannot be negative", label)
+                }
+                if interval.ActiveVUs != nil && *interval.ActiveVUs < 0 {
+                        return fmt.Errorf("interval %s: active_vus cannot be negative", label)
+                }
+                if err := validatePercentiles(models.EndpointMetrics{
+                        P50: interval.P50, P90: interval.P90, P95: interval.P95, P99: interval.P99,
+                }); err != nil {
+                        return fmt.Errorf("interval %s: %w", label, err)
+                }
+
+                if interval.RPS == nil && interval.Requests > 0 {
+                        rps := float64(interval.Requests) / interval.DurationSeconds
+                        interval.RPS = &rps
+                }
+        }
+
+        sort.Slice(req.Intervals, func(i, j int) bool {
+                return req.Intervals[i].Start.Before(req.Intervals[j].Start)
+        })
+        return nil
+}
+
+// GetMetricIntervals returns the time series stored with a test result
+func (a *Analyzer) GetMetricIntervals(ctx context.Context, testResultID int) ([]models.MetricInterval, error) {
+        query := `
+                SELECT id, test_result_id, start_time, duration_seconds, rps, active_vus, p50, p90, p95, p99, requests, errors
+                FROM metric_intervals
+                WHERE test_result_id = $1
+                ORDER BY start_time`
+
+        rows, err := a.db.Query(ctx, query, testResultID)
+        if err != nil {
+                return nil, err
+        }
+        defer rows.Close()
+
+        intervals := []models.MetricInterval{}
+        for rows.Next() {
+                var interval models.MetricInterval
+                err := rows.Scan(&interval.ID, &interval.TestResultID, &interval.Start, &interval.DurationSeconds,
+                        &interval.RPS, &interval.ActiveVUs, &interval.P50, &interval.P90, &interval.P95, &interval.P99,
+                        &interval.Requests, &interval.Errors)
+                if err != nil {
+                        return nil, err
+                }
+                intervals = append(intervals, interval)
+        }
+
+        return intervals, rows.Err()
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+        "bufio"
+        "bytes"
+        "encoding/csv"
+        "encoding/json"
+        "encoding/xml"
+        "fmt"
+        "io"
+        "strconv"
+        "strings"
+        "time"
+
+        "github.com/performance-analyzer/models"
+)
+
+func init() {
+        RegisterResultsParser("jmeter", ResultsParserFunc(ParseJMeterResults))
+}
+
+// jtlDefaultColumns is the CSV column order JMeter writes when field names are not saved
+var jtlDefaultColumns = []string{
+        "timeStamp", "elapsed", "label", "responseCode", "responseMessage", "threadName",
+        "dataType", "success", "failureMessage", "bytes", "sentBytes", "grpThreads",
+        "allThreads", "URL", "Latency", "IdleTime", "Connect",
+}
+
+// ParseJMeterResults aggregates a JMeter JTL file (CSV or XML) by sample label.
+// The input is read as a stream, so soak test results of any size use constant memory
+// apart from the per-label latency counts.
+func ParseJMeterResults(r io.Reader, project *models.Project) (*models.SendResultsRequest, error) {
+        reader := bufio.NewReaderSize(r, 64*1024)
+        head, _ := reader.Peek(512)
+
+        aggregator := newSampleAggregator()
+        var skipped int
+        var err error
+        format := "csv"
+        if trimmed := bytes.TrimSpace(head); len(trimmed) > 0 && trimmed[0] == '<' {
+                format = "xml"
+                skipped, err = readJTLXML(reader, aggregator)
+        } else {
+                skipped, err = readJTLCSV(reader, aggregator)
+        }
+        if err != nil {
+                return nil, err
+        }
+
+        req := aggregator.Result()
+        if req.SuccessfulCalls+req.FailedCalls == 0 {
+                return nil, fmt.Errorf("JTL file has no samples")
+        }
+
+        raw := map[string]interface{}{
+                "source":          "jmeter",
+                "jtl_format":      format,
+                "samples":         req.SuccessfulCalls + req.FailedCalls,
+                "skipped_samples": skipped,
+                "assertions":      evaluateImportedNFRs(project, req),
+        }
+        req.RawResults, _ = json.Marshal(raw)
+
+        return req, nil
+}
+
+// readJTLCSV reads CSV samples; rows that cannot be read are counted and skipped
+func readJTLCSV(r io.Reader, aggregator *sampleAggregator) (int, error) {
+        reader := csv.NewReader(r)
+        reader.FieldsPerRecord = -1
+        reader.LazyQuotes = true
+        reader.ReuseRecord = true
+
+        first, err := reader.Read()
+        if err == io.EOF {
+                return 0, fmt.Errorf("JTL file is empty")
+        }
+        if err != nil {
+                return 0, fmt.Errorf("invalid JTL CSV: %w", err)
+        }
+
+        columns := make(map[string]int)
+        first[0] = strings.TrimPrefix(first[0], "\ufeff")
+        headerless := isInteger(strings.TrimSpace(first[0]))
+        names := first
+        if headerless {
+                names = jtlDefaultColumns
+        }
+        for i, name := range names {
+                columns[strings.TrimSpace(name)] = i
+        }
+        for _, required := range []string{"timeStamp", "elapsed", "label", "success"} {
+                if _, ok := columns[required]; !ok {
+                        return 0, fmt.Errorf("JTL CSV has no %s column", required)
+                }
+        }
+
+        field := func(record []string, name string) string {
+                if i, ok := columns[name]; ok && i < len(record) {
+                        return record[i]
+                }
+                return ""
+        }
+
+        skipped := 0
+        add := func(record []string) {
+                timestamp, err1 := strconv.ParseInt(field(record, "timeStamp"), 10, 64)
+                elapsed, err2 := strconv.ParseInt(field(record, "elapsed"), 10, 64)
+                if err1 != nil || err2 != nil {
+                        skipped++
+                        return
+                }
+                ok := strings.EqualFold(field(record, "success"), "true")
+                aggregator.Add(field(record, "label"), time.UnixMilli(timestamp), time.Duration(elapsed)*time.Millisecond, ok, jtlErrorCode(field(record, "responseCode"), field(record, "failureMessage")))
+                if threads, err := strconv.Atoi(field(record, "allThreads")); err == nil {
+                        aggregator.ObserveVUs(time.UnixMilli(timestamp), threads)
+                }
+        }
+
+        if headerless {
+                add(first)
+        }
+        for {
+                record, err := reader.Read()
+                if err == io.EOF {
+                        break
+                }
+                if err != nil {
+                        if _, ok := err.(*csv.ParseError); ok {
+                                skipped++
+                                continue
+                        }
+                        return skipped, fmt.Errorf("failed to read JTL CSV: %w", err)
+                }
+                add(record)
+        }
+
+        return skipped, nil
+}
+
+// readJTLXML reads top-level <httpSample> and <sample> elements; nested subresults
+// (redirects, embedded resources, transaction children) are part of their parent
+func readJTLXML(r io.Reader, aggregator *sampleAggregator) (int, error) {
+        decoder := xml.NewDecoder(r)
+        depth := 0
+        skipped := 0
+
+        for {
+                token, err := decoder.Token()
+                if err == io.EOF {
+                        break
+                }
+                if err != nil {
+                        return skipped, fmt.Errorf("invalid JTL XML: %w", err)
+                }
+
+                switch element := token.(type) {
+                case xml.StartElement:
+                        depth++
+                        if depth != 2 || (element.Name.Local != "httpSample" && element.Name.Local != "sample") {
+                                continue
+                        }
+
+                        attrs := make(map[string]string, len(element.Attr))
+                        for _, attr := range element.Attr {
+                                attrs[attr.Name.Local] = attr.Value
+                        }
+                        timestamp, err1 := strconv.ParseInt(attrs["ts"], 10, 64)
+                        elapsed, err2 := strconv.ParseInt(attrs["t"], 10, 64)
+                        if err1 != nil || err2 != nil {
+                                skipped++
+                                continue
+                        }
+                        aggregator.Add(attrs["lb"], time.UnixMilli(timestamp), time.Duration(elapsed)*time.Millisecond, attrs["s"] == "true", jtlErrorCode(attrs["rc"], ""))
+                        if threads, err := strconv.Atoi(attrs["na"]); err == nil {
+                                aggregator.ObserveVUs(time.UnixMilli(timestamp), threads)
+                        }
+                case xml.EndElement:
+                        depth--
+                }
+        }
+
+        return skipped, nil
+}
+
+// jtlErrorCode prefers the response code and falls back to the failure message
+func jtlErrorCode(responseCode, failureMessage string) string {
+        if code := strings.TrimSpace(responseCode); code != "" {
+                return truncateErrorCode(code)
+        }
+        return truncateErrorCode(failureMessage)
+}
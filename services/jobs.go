@@ -0,0 +1,426 @@
+package services
+
+import (
+        "context"
+        "errors"
+        "fmt"
+        "log"
+        "os"
+        "time"
+
+        "github.com/google/uuid"
+        "github.com/jackc/pgx/v5"
+        "github.com/jackc/pgx/v5/pgxpool"
+        "github.com/performance-analyzer/models"
+)
+
+const (
+        // jobPollInterval is how often an idle worker looks for jobs enqueued by other instances
+        jobPollInterval = 2 * time.Second
+        // jobLeaseDuration is how long a claimed job stays reserved for its worker without a
+        // heartbeat; a job whose lease ran out is taken to be abandoned by a dead instance and
+        // is claimed again
+        jobLeaseDuration = 2 * time.Minute
+        // jobHeartbeatInterval is how often a worker extends the lease of the job it runs
+        jobHeartbeatInterval = 30 * time.Second
+        // defaultJobMaxAttempts is how many times a job is claimed before it is given up
+        defaultJobMaxAttempts = 3
+)
+
+// errLeaseLost is the cause a job is cancelled with when its worker no longer holds the lease
+var errLeaseLost = errors.New("job lease lost")
+
+// JobQueue is the durable queue of background work kept in the jobs table. Workers of any
+// number of server instances claim jobs with SELECT ... FOR UPDATE SKIP LOCKED, so a job is
+// processed by one worker at a time and survives restarts.
+type JobQueue struct {
+        db       *pgxpool.Pool
+        workerID string
+        // wake lets a local enqueue start an idle worker without waiting for the next poll
+        wake chan struct{}
+}
+
+func NewJobQueue(db *pgxpool.Pool) *JobQueue {
+        hostname, err := os.Hostname()
+        if err != nil {
+                hostname = "unknown"
+        }
+        return &JobQueue{
+                db:       db,
+                workerID: fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8]),
+                wake:     make(chan struct{}, 1),
+        }
+}
+
+// Enqueue adds a job of the given kind for the project. A job of the same kind that is
+// still waiting to run already covers the request, so no duplicate is added.
+func (q *JobQueue) Enqueue(ctx context.Context, kind string, projectUUID uuid.UUID) error {
+        return q.enqueue(ctx, kind, projectUUID, nil)
+}
+
+// EnqueueFile adds a job of the given kind for one file of the project
+func (q *JobQueue) EnqueueFile(ctx context.Context, kind string, projectUUID uuid.UUID, fileID int) error {
+        return q.enqueue(ctx, kind, projectUUID, &fileID)
+}
+
+func (q *JobQueue) enqueue(ctx context.Context, kind string, projectUUID uuid.UUID, fileID *int) error {
+        _, err := q.db.Exec(ctx,
+                `INSERT INTO jobs (kind, project_uuid, file_id, max_attempts)
+                 VALUES ($1, $2, $3, $4)
+                 ON CONFLICT (kind, project_uuid, COALESCE(file_id, 0)) WHERE status = 'queued' DO NOTHING`,
+                kind, projectUUID, fileID, defaultJobMaxAttempts)
+        if err != nil {
+                return fmt.Errorf("failed to enqueue %s job: %w", kind, err)
+        }
+
+        q.notify()
+        return nil
+}
+
+// notify wakes an idle worker of this instance
+func (q *JobQueue) notify() {
+        select {
+        case q.wake <- struct{}{}:
+        default:
+        }
+}
+
+// Claim leases the next due job to this worker: a queued job whose next_run_at has come, or
+// a running job whose lease expired. Jobs of a project (or of a file) that another worker
+// is processing are skipped. Tenants take turns: the job goes to the tenant with the fewest jobs running
+// on all instances, so a large batch of one tenant cannot hold every worker. It returns nil
+// when there is nothing to do.
+func (q *JobQueue) Claim(ctx context.Context) (*models.Job, error) {
+        var job models.Job
+        err := q.db.QueryRow(ctx, `
+                UPDATE jobs
+                SET status = 'running', attempts = attempts + 1, locked_by = $1,
+                    lease_expires_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second',
+                    heartbeat_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+                WHERE id = (
+                    SELECT j.id FROM jobs j
+                    JOIN projects p ON p.uuid = j.project_uuid
+                    WHERE ((j.status = 'queued' AND j.next_run_at <= CURRENT_TIMESTAMP)
+                        OR (j.status = 'running' AND j.lease_expires_at < CURRENT_TIMESTAMP))
+                      AND NOT EXISTS (
+                          SELECT 1 FROM jobs r
+                          WHERE r.kind = j.kind AND r.project_uuid = j.project_uuid
+                            AND r.file_id IS NOT DISTINCT FROM j.file_id AND r.id <> j.id
+                            AND r.status = 'running' AND r.lease_expires_at >= CURRENT_TIMESTAMP)
+                    ORDER BY (
+                          SELECT COUNT(*) FROM jobs r
+                          JOIN projects rp ON rp.uuid = r.project_uuid
+                          WHERE rp.tenant = p.tenant
+                            AND r.status = 'running' AND r.lease_expires_at >= CURRENT_TIMESTAMP),
+                        j.next_run_at, j.id
+                    LIMIT 1
+                    FOR UPDATE OF j SKIP LOCKED
+                )
+                RETURNING id, kind, project_uuid, file_id, status, attempts, max_attempts, next_run_at,
+                          locked_by, lease_expires_at, heartbeat_at, last_error, created_at, updated_at`,
+                q.workerID, jobLeaseDuration.Seconds()).Scan(
+                &job.ID, &job.Kind, &job.ProjectUUID, &job.FileID, &job.Status, &job.Attempts, &job.MaxAttempts, &job.NextRunAt,
+                &job.LockedBy, &job.LeaseExpiresAt, &job.HeartbeatAt, &job.LastError, &job.CreatedAt, &job.UpdatedAt)
+        if errors.Is(err, pgx.ErrNoRows) {
+                return nil, nil
+        }
+        if err != nil {
+                return nil, fmt.Errorf("failed to claim job: %w", err)
+        }
+        return &job, nil
+}
+
+// Complete marks a job done, or failed with its error. Only the worker holding the lease
+// may finish the job.
+func (q *JobQueue) Complete(ctx context.Context, job *models.Job, jobErr error) error {
+        status := models.JobDone
+        var lastError *string
+        if jobErr != nil {
+                status = models.JobFailed
+                message := jobErr.Error()
+                lastError = &message
+        }
+
+        tag, err := q.db.Exec(ctx,
+                `UPDATE jobs
+                 SET status = $1, last_error = COALESCE($2, last_error), locked_by = NULL,
+                     lease_expires_at = NULL, updated_at = CURRENT_TIMESTAMP
+                 WHERE id = $3 AND locked_by = $4 AND attempts = $5 AND status = 'running'`,
+                status, lastError, job.ID, q.workerID, job.Attempts)
+        if err != nil {
+                return fmt.Errorf("failed to complete job %d: %w", job.ID, err)
+        }
+        if tag.RowsAffected() == 0 {
+                return fmt.Errorf("job %d is no longer leased by %s", job.ID, q.workerID)
+        }
+        return nil
+}
+
+// Heartbeat extends the lease of a running job. It fails with errLeaseLost when the lease
+// was lost, which happens when the worker stalled for longer than the lease and another
+// worker took the job.
+func (q *JobQueue) Heartbeat(ctx context.Context, job *models.Job) error {
+        tag, err := q.db.Exec(ctx,
+                `UPDATE jobs
+                 SET heartbeat_at = CURRENT_TIMESTAMP,
+                     lease_expires_at = CURRENT_TIMESTAMP + $1 * INTERVAL '1 second'
+                 WHERE id = $2 AND locked_by = $3 AND attempts = $4 AND status = 'running'`,
+                jobLeaseDuration.Seconds(), job.ID, q.workerID, job.Attempts)
+        if err != nil {
+                return fmt.Errorf("failed to extend lease of job %d: %w", job.ID, err)
+        }
+        if tag.RowsAffected() == 0 {
+                return fmt.Errorf("job %d is no longer leased by %s: %w", job.ID, q.workerID, errLeaseLost)
+        }
+        return nil
+}
+
+// keepLeased sends heartbeats for the job until done is closed or ctx is cancelled. When
+// the lease is lost it cancels the job with errLeaseLost, so the stale worker stops instead
+// of repeating the work of the worker that took the job over.
+func (q *JobQueue) keepLeased(ctx context.Context, job *models.Job, done <-chan struct{}, cancel context.CancelCauseFunc) {
+        ticker := time.NewTicker(jobHeartbeatInterval)
+        defer ticker.Stop()
+        for {
+                select {
+                case <-done:
+                        return
+                case <-ctx.Done():
+                        return
+                case <-ticker.C:
+                        err := q.Heartbeat(ctx, job)
+                        if errors.Is(err, errLeaseLost) {
+                                log.Printf("%s job %d lost its lease, stopping it: %v", job.Kind, job.ID, err)
+                                cancel(errLeaseLost)
+                                return
+                        } else if err != nil {
+                                log.Printf("Heartbeat of %s job %d failed: %v", job.Kind, job.ID, err)
+                        }
+                }
+        }
+}
+
+// Retry queues a failed job again after the delay. When a newer job of the same kind is
+// already queued for the project it covers the retry, and this job is closed instead.
+func (q *JobQueue) Retry(ctx context.Context, job *models.Job, jobErr error, delay time.Duration) error {
+        tag, err := q.db.Exec(ctx,
+                `UPDATE jobs
+                 SET status = CASE WHEN EXISTS (
+                         SELECT 1 FROM jobs n
+                         WHERE n.kind = jobs.kind AND n.project_uuid = jobs.project_uuid
+                           AND n.file_id IS NOT DISTINCT FROM jobs.file_id AND n.status = 'queued'
+                     ) THEN 'done' ELSE 'queued' END,
+                     next_run_at = CURRENT_TIMESTAMP + $1 * INTERVAL '1 second',
+                     last_error = $2, locked_by = NULL, lease_expires_at = NULL, updated_at = CURRENT_TIMESTAMP
+                 WHERE id = $3 AND locked_by = $4 AND attempts = $5 AND status = 'running'`,
+                delay.Seconds(), jobErr.Error(), job.ID, q.workerID, job.Attempts)
+        if err != nil {
+                return fmt.Errorf("failed to requeue job %d: %w", job.ID, err)
+        }
+        if tag.RowsAffected() == 0 {
+                return fmt.Errorf("job %d is no longer leased by %s", job.ID, q.workerID)
+        }
+        return nil
+}
+
+// waitForWork blocks until a job is enqueued locally, the poll interval passes or stop is closed
+func (q *JobQueue) waitForWork(stop <-chan struct{}) {
+        select {
+        case <-q.wake:
+        case <-time.After(jobPollInterval):
+        case <-stop:
+        }
+}
+
+// Release hands a job interrupted by a shutdown back to the queue. The attempt does not
+// count, so the job is not given up because of deploys.
+func (q *JobQueue) Release(ctx context.Context, job *models.Job) error {
+        tag, err := q.db.Exec(ctx,
+                `UPDATE jobs
+                 SET status = CASE WHEN EXISTS (
+                         SELECT 1 FROM jobs n
+                         WHERE n.kind = jobs.kind AND n.project_uuid = jobs.project_uuid
+                           AND n.file_id IS NOT DISTINCT FROM jobs.file_id AND n.status = 'queued'
+                     ) THEN 'done' ELSE 'queued' END,
+                     attempts = GREATEST(attempts - 1, 0), next_run_at = CURRENT_TIMESTAMP,
+                     locked_by = NULL, lease_expires_at = NULL, updated_at = CURRENT_TIMESTAMP
+                 WHERE id = $1 AND locked_by = $2 AND attempts = $3 AND status = 'running'`,
+                job.ID, q.workerID, job.Attempts)
+        if err != nil {
+                return fmt.Errorf("failed to release job %d: %w", job.ID, err)
+        }
+        if tag.RowsAffected() == 0 {
+                return fmt.Errorf("job %d is no longer leased by %s", job.ID, q.workerID)
+        }
+        return nil
+}
+
+// StartBackgroundProcessor starts the given number of workers consuming the job queue
+// until Shutdown
+func (a *Analyzer) StartBackgroundProcessor(workers int) {
+        if workers < 1 {
+                workers = 1
+        }
+        ctx, cancel := context.WithCancel(context.Background())
+        a.cancelJobs = cancel
+
+        log.Printf("Starting background analyzer processor %s with %d workers...", a.jobs.workerID, workers)
+        for i := 0; i < workers; i++ {
+                a.workers.Add(1)
+                go func() {
+                        defer a.workers.Done()
+                        a.processJobs(ctx)
+                }()
+        }
+}
+
+// Shutdown stops the workers from claiming jobs and waits for the running ones to finish.
+// Jobs still running when ctx is done are cancelled and handed back to the queue.
+func (a *Analyzer) Shutdown(ctx context.Context) error {
+        close(a.stopping)
+
+        drained := make(chan struct{})
+        go func() {
+                a.workers.Wait()
+                close(drained)
+        }()
+
+        select {
+        case <-drained:
+                log.Println("Background analyzer processor stopped")
+                return nil
+        case <-ctx.Done():
+                log.Println("Shutdown deadline passed, cancelling running analyses")
+                if a.cancelJobs != nil {
+                        a.cancelJobs()
+                }
+                <-drained
+                return ctx.Err()
+        }
+}
+
+// processJobs is one worker: it claims and runs jobs until Shutdown
+func (a *Analyzer) processJobs(ctx context.Context) {
+        for {
+                select {
+                case <-a.stopping:
+                        return
+                default:
+                }
+
+                job, err := a.jobs.Claim(ctx)
+                if err != nil {
+                        log.Printf("Failed to poll job queue: %v", err)
+                        a.jobs.waitForWork(a.stopping)
+                        continue
+                }
+                if job == nil {
+                        a.jobs.waitForWork(a.stopping)
+                        continue
+                }
+                a.runJob(ctx, job)
+        }
+}
+
+// runJob processes a claimed job and records its outcome. Transient failures are queued
+// again with backoff while the job has attempts left.
+func (a *Analyzer) runJob(ctx context.Context, job *models.Job) {
+        // The job runs under its own context, cancelled by shutdown or when its lease is lost
+        jobCtx, cancelJob := context.WithCancelCause(ctx)
+        defer cancelJob(nil)
+
+        var jobErr error
+        if job.Attempts > job.MaxAttempts {
+                // The lease of every earlier attempt ran out, most likely because the job crashes the worker
+                jobErr = fmt.Errorf("job was abandoned %d times, giving up", job.MaxAttempts)
+        } else {
+                log.Printf("Processing %s job %d for project %s (attempt %d)", job.Kind, job.ID, job.ProjectUUID, job.Attempts)
+                done := make(chan struct{})
+                go a.jobs.keepLeased(jobCtx, job, done, cancelJob)
+                switch job.Kind {
+                case models.JobKindFinalAnalysis:
+                        jobErr = a.processAnalysis(jobCtx, job.ProjectUUID)
+                case models.JobKindInputReview:
+                        jobErr = a.processInputReview(jobCtx, job.ProjectUUID)
+                case models.JobKindFileAnalysis:
+                        if job.FileID == nil {
+                                jobErr = fmt.Errorf("file analysis job has no file")
+                        } else {
+                                jobErr = a.processFileAnalysis(jobCtx, job.ProjectUUID, *job.FileID)
+                        }
+                default:
+                        jobErr = fmt.Errorf("unknown job kind %q", job.Kind)
+                }
+                close(done)
+        }
+
+        // The job belongs to the worker that took it over, which records its outcome
+        if errors.Is(context.Cause(jobCtx), errLeaseLost) {
+                log.Printf("%s job %d for project %s was taken over by another worker, dropped", job.Kind, job.ID, job.ProjectUUID)
+                return
+        }
+
+        // The outcome is recorded even when the job was cancelled, so it is not left leased
+        ctx = context.WithoutCancel(ctx)
+
+        if jobErr != nil && jobCtx.Err() != nil {
+                log.Printf("%s job %d for project %s was interrupted by shutdown, queued again", job.Kind, job.ID, job.ProjectUUID)
+                a.markJobRetrying(ctx, job, "Interrupted by server shutdown, queued again")
+                if err := a.jobs.Release(ctx, job); err != nil {
+                        log.Printf("Failed to record outcome of job %d: %v", job.ID, err)
+                }
+                return
+        }
+
+        if jobErr == nil {
+                if err := a.jobs.Complete(ctx, job, nil); err != nil {
+                        log.Printf("Failed to record outcome of job %d: %v", job.ID, err)
+                }
+                return
+        }
+
+        if isTransient(jobErr) && job.Attempts < job.MaxAttempts {
+                delay := backoffDelay(job.Attempts, jobRetryBaseDelay, jobRetryMaxDelay)
+                log.Printf("%s job %d for project %s failed, retrying in %v: %v", job.Kind, job.ID, job.ProjectUUID, delay, jobErr)
+                message := fmt.Sprintf("Attempt %d of %d failed, retrying in %v: %v", job.Attempts, job.MaxAttempts, delay.Round(time.Second), jobErr)
+                a.markJobRetrying(ctx, job, message)
+                if err := a.jobs.Retry(ctx, job, jobErr, delay); err != nil {
+                        log.Printf("Failed to record outcome of job %d: %v", job.ID, err)
+                }
+                return
+        }
+
+        log.Printf("%s job %d for project %s failed: %v", job.Kind, job.ID, job.ProjectUUID, jobErr)
+        a.markJobFailed(ctx, job, jobErr.Error())
+        if err := a.jobs.Complete(ctx, job, jobErr); err != nil {
+                log.Printf("Failed to record outcome of job %d: %v", job.ID, err)
+        }
+}
+
+// markJobRetrying shows on the analysis, review or file of a job that it is queued again
+func (a *Analyzer) markJobRetrying(ctx context.Context, job *models.Job, message string) {
+        switch job.Kind {
+        case models.JobKindFinalAnalysis:
+                a.markAnalysisRetrying(ctx, job.ProjectUUID, message)
+        case models.JobKindInputReview:
+                a.markInputReviewRetrying(ctx, job.ProjectUUID, message)
+        case models.JobKindFileAnalysis:
+                if job.FileID != nil {
+                        a.markFileAnalysisRetrying(ctx, *job.FileID, message)
+                }
+        }
+}
+
+// markJobFailed records the final failure of a job on its analysis, review or file
+func (a *Analyzer) markJobFailed(ctx context.Context, job *models.Job, message string) {
+        switch job.Kind {
+        case models.JobKindFinalAnalysis:
+                a.markAnalysisFailed(ctx, job.ProjectUUID, message)
+        case models.JobKindInputReview:
+                a.markInputReviewFailed(ctx, job.ProjectUUID, message)
+        case models.JobKindFileAnalysis:
+                if job.FileID != nil {
+                        a.markFileAnalysisFailed(ctx, job.ProjectUUID, *job.FileID, message)
+                }
+        }
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+        "encoding/json"
+        "fmt"
+        "io"
+        "math"
+        "sort"
+        "strings"
+
+        "github.com/performance-analyzer/models"
+)
+
+func init() {
+        RegisterResultsParser("k6", ResultsParserFunc(func(r io.Reader, _ *models.Project) (*models.SendResultsRequest, error) {
+                return ParseK6Summary(r)
+        }))
+}
+
+// k6Summary covers both the --summary-export file and the handleSummary data object
+type k6Summary struct {
+        RootGroup json.RawMessage `json:"root_group"`
+        State     *struct {
+                TestRunDurationMs float64 `json:"testRunDurationMs"`
+        } `json:"state"`
+        Metrics map[string]map[string]json.RawMessage `json:"metrics"`
+}
+
+// k6Metric is a metric with its values flattened to numbers
+type k6Metric struct {
+        values     map[string]float64
+        thresholds map[string]bool // threshold expression -> ok
+}
+
+// k6Check is a check outcome collected from the group tree
+type k6Check struct {
+        Name   string `json:"name"`
+        Path   string `json:"path"`
+        Passes int    `json:"passes"`
+        Fails  int    `json:"fails"`
+}
+
+// k6Threshold is a threshold outcome of a metric
+type k6Threshold struct {
+        Metric    string `json:"metric"`
+        Threshold string `json:"threshold"`
+        OK        bool   `json:"ok"`
+}
+
+// ParseK6Summary converts a k6 end-of-test summary (--summary-export or handleSummary JSON)
+// into the results model. Per-endpoint metrics come from tagged submetrics such as
+// http_req_duration{name:GET /items}, http_req_duration{url:...} or http_req_duration{group:::checkout}.
+func ParseK6Summary(r io.Reader) (*models.SendResultsRequest, error) {
+        var summary k6Summary
+        if err := json.NewDecoder(r).Decode(&summary); err != nil {
+                return nil, fmt.Errorf("invalid k6 summary JSON: %w", err)
+        }
+        if len(summary.Metrics) == 0 {
+                return nil, fmt.Errorf("k6 summary has no metrics")
+        }
+
+        metrics := make(map[string]k6Metric, len(summary.Metrics))
+        for name, raw := range summary.Metrics {
+                metrics[name] = parseK6Metric(raw)
+        }
+
+        req := &models.SendResultsRequest{}
+
+        total := int(metrics["http_reqs"].values["count"])
+        failed := int(metrics["http_req_failed"].values["passes"])
+        if total == 0 {
+                return nil, fmt.Errorf("k6 summary has no http_reqs")
+        }
+        req.SuccessfulCalls = total - failed
+        req.FailedCalls = failed
+
+        if rate, ok := metrics["http_reqs"].values["rate"]; ok {
+                req.AchievedRPS = &rate
+        }
+        if summary.State != nil && summary.State.TestRunDurationMs > 0 {
+                req.TestDuration, _ = json.Marshal(summary.State.TestRunDurationMs / 1000)
+        }
+
+        req.Endpoints = k6Endpoints(metrics)
+
+        var thresholds []k6Threshold
+        for name, metric := range metrics {
+                for expression, ok := range metric.thresholds {
+                        thresholds = append(thresholds, k6Threshold{Metric: name, Threshold: expression, OK: ok})
+                }
+        }
+        sort.Slice(thresholds, func(i, j int) bool {
+                if thresholds[i].Metric != thresholds[j].Metric {
+                        return thresholds[i].Metric < thresholds[j].Metric
+                }
+                return thresholds[i].Threshold < thresholds[j].Threshold
+        })
+
+        var checks []k6Check
+        collectK6Checks(summary.RootGroup, &checks)
+
+        raw := map[string]interface{}{
+                "source":            "k6",
+                "checks":            checks,
+                "thresholds":        thresholds,
+                "iterations":        metrics["iterations"].values["count"],
+                "vus_max":           metrics["vus_max"].values["max"],
+                "http_req_duration": metrics["http_req_duration"].values,
+                "data_sent":         metrics["data_sent"].values["count"],
+                "data_received":     metrics["data_received"].values["count"],
+                "checks_rate":       metrics["checks"].values,
+        }
+        req.RawResults, _ = json.Marshal(raw)
+
+        return req, nil
+}
+
+// parseK6Metric reads values from "values" (handleSummary) or from the metric object itself (summary-export)
+func parseK6Metric(raw map[string]json.RawMessage) k6Metric {
+        metric := k6Metric{values: make(map[string]float64), thresholds: make(map[string]bool)}
+
+        if nested, ok := raw["values"]; ok {
+                json.Unmarshal(nested, &metric.values)
+        } else {
+                for key, value := range raw {
+                        var number float64
+                        if json.Unmarshal(value, &number) == nil {
+                                metric.values[key] = number
+                        }
+                }
+        }
+
+        var thresholds map[string]json.RawMessage
+        if json.Unmarshal(raw["thresholds"], &thresholds) == nil {
+                for expression, value := range thresholds {
+                        // summary-export stores whether the threshold failed, handleSummary stores {"ok": bool}
+                        var failed bool
+                        if json.Unmarshal(value, &failed) == nil {
+                                metric.thresholds[expression] = !failed
+                                continue
+                        }
+                        var outcome struct {
+                                OK bool `json:"ok"`
+                        }
+                        if json.Unmarshal(value, &outcome) == nil {
+                                metric.thresholds[expression] = outcome.OK
+                        }
+                }
+        }
+
+        return metric
+}
+
+// k6Endpoints builds endpoints from tagged http_req_duration submetrics,
+// or a single run-wide endpoint when the script defines none
+func k6Endpoints(metrics map[string]k6Metric) []models.EndpointMetrics {
+        var endpoints []models.EndpointMetrics
+        for name, metric := range metrics {
+                base, tags := splitK6MetricName(name)
+                if base != "http_req_duration" || len(tags) == 0 {
+                        continue
+                }
+
+                endpoint := k6Endpoint(tags, metric)
+                if endpoint.Name == "" {
+                        continue
+                }
+
+                // Counters with the same tag set give the request and error counts
+                suffix := name[len(base):]
+                endpoint.Requests = int(metrics["http_reqs"+suffix].values["count"])
+                endpoint.Errors = int(metrics["http_req_failed"+suffix].values["passes"])
+                if rate, ok := metrics["http_reqs"+suffix].values["rate"]; ok {
+                        endpoint.RPS = &rate
+                }
+                endpoints = append(endpoints, endpoint)
+        }
+
+        if len(endpoints) == 0 {
+                if overall, ok := metrics["http_req_duration"]; ok {
+                        endpoint := k6Endpoint(map[string]string{"name": "all requests"}, overall)
+                        endpoint.Requests = int(metrics["http_reqs"].values["count"])
+                        endpoint.Errors = int(metrics["http_req_failed"].values["passes"])
+                        if rate, ok := metrics["http_reqs"].values["rate"]; ok {
+                                endpoint.RPS = &rate
+                        }
+                        endpoints = append(endpoints, endpoint)
+                }
+        }
+
+        sort.Slice(endpoints, func(i, j int) bool {
+                return EndpointLabel(endpoints[i]) < EndpointLabel(endpoints[j])
+        })
+        return dedupeEndpoints(endpoints)
+}
+
+func k6Endpoint(tags map[string]string, metric k6Metric) models.EndpointMetrics {
+        endpoint := models.EndpointMetrics{Method: strings.ToUpper(tags["method"])}
+
+        switch {
+        case tags["name"] != "":
+                endpoint.Name = tags["name"]
+        case tags["url"] != "":
+                endpoint.Name = tags["url"]
+        case tags["group"] != "":
+                endpoint.Name = "group " + tags["group"]
+        }
+
+        // A name tag like "GET /items" carries the method itself
+        if endpoint.Method == "" {
+                endpoint.Method, endpoint.Name = splitEndpointKey(endpoint.Name)
+        }
+        if !httpMethods[endpoint.Method] {
+                endpoint.Method = ""
+        }
+
+        endpoint.P50 = k6Value(metric, "med", "p(50)")
+        endpoint.P90 = k6Value(metric, "p(90)")
+        endpoint.P95 = k6Value(metric, "p(95)")
+        endpoint.P99 = k6Value(metric, "p(99)")
+        endpoint.Max = k6Value(metric, "max")
+        return endpoint
+}
+
+func k6Value(metric k6Metric, keys ...string) *float64 {
+        for _, key := range keys {
+                if value, ok := metric.values[key]; ok && !math.IsNaN(value) {
+                        return &value
+                }
+        }
+        return nil
+}
+
+// splitK6MetricName splits "http_req_duration{name:GET /items,method:GET}" into the base name and tags
+func splitK6MetricName(name string) (string, map[string]string) {
+        open := strings.Index(name, "{")
+        if open == -1 || !strings.HasSuffix(name, "}") {
+                return name, nil
+        }
+
+        tags := make(map[string]string)
+        for _, pair := range strings.Split(name[open+1:len(name)-1], ",") {
+                key, value, ok := strings.Cut(pair, ":")
+                if !ok {
+                        continue
+                }
+                tags[strings.TrimSpace(key)] = strings.TrimSpace(value)
+        }
+        return name[:open], tags
+}
+
+// dedupeEndpoints keeps the first of several submetrics that resolve to the same endpoint
+func dedupeEndpoints(endpoints []models.EndpointMetrics) []models.EndpointMetrics {
+        seen := make(map[string]bool)
+        result := make([]models.EndpointMetrics, 0, len(endpoints))
+        for _, endpoint := range endpoints {
+                label := EndpointLabel(endpoint)
+                if seen[label] {
+                        continue
+                }
+                seen[label] = true
+                result = append(result, endpoint)
+        }
+        return result
+}
+
+// collectK6Checks walks the group tree; groups and checks are arrays in recent k6 versions
+// and maps keyed by name in older summary exports
+func collectK6Checks(raw json.RawMessage, checks *[]k6Check) {
+        if len(raw) == 0 {
+                return
+        }
+
+        var group struct {
+                Groups json.RawMessage `json:"groups"`
+                Checks json.RawMessage `json:"checks"`
+        }
+        if json.Unmarshal(raw, &group) != nil {
+                return
+        }
+
+        var checkList []k6Check
+        if json.Unmarshal(group.Checks, &checkList) != nil {
+                var checkMap map[string]k6Check
+                if json.Unmarshal(group.Checks, &checkMap) == nil {
+                        for _, check := range checkMap {
+                                checkList = append(checkList, check)
+                        }
+                }
+        }
+        *checks = append(*checks, checkList...)
+
+        var groupList []json.RawMessage
+        if json.Unmarshal(group.Groups, &groupList) != nil {
+                var groupMap map[string]json.RawMessage
+                if json.Unmarshal(group.Groups, &groupMap) == nil {
+                        for _, child := range groupMap {
+                                groupList = append(groupList, child)
+                        }
+                }
+        }
+        for _, child := range groupList {
+                collectK6Checks(child, checks)
+        }
+}
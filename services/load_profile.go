@@ -0,0 +1,310 @@
+package services
+
+import (
+        "fmt"
+        "sort"
+        "time"
+
+        "github.com/performance-analyzer/models"
+)
+
+const (
+        // A VU level is saturated when 20% more users add less than 5% throughput
+        saturationVUGrowth  = 1.2
+        saturationRPSGrowth = 1.05
+        // latencyDegradationFactor is how much p95 may grow within a stage without more throughput
+        latencyDegradationFactor = 1.5
+)
+
+// plannedStage is a declared stage placed on the test timeline
+type plannedStage struct {
+        name      string
+        offset    time.Duration
+        duration  time.Duration
+        targetRPS float64
+        targetVUs int
+}
+
+// EvaluateLoadProfile compares the achieved time series with the load profile declared in
+// project_info: whether every stage ran and reached its target, whether latency degraded
+// within a stage, and at which VU level throughput saturated
+func EvaluateLoadProfile(info models.ProjectInfo, intervals []models.MetricInterval) models.LoadProfileConformance {
+        conformance := models.LoadProfileConformance{
+                Stages:   []models.StageConformance{},
+                Findings: []models.LoadProfileFinding{},
+        }
+        if len(intervals) == 0 {
+                conformance.Detail = "No time-series metrics were submitted"
+                return conformance
+        }
+        conformance.Evaluated = true
+
+        origin := intervals[0].Start
+        last := intervals[len(intervals)-1]
+        span := last.Start.Add(time.Duration(last.DurationSeconds * float64(time.Second))).Sub(origin)
+
+        stages, complete := plannedStages(info)
+        if len(stages) == 0 {
+                // Without declared stages the whole run is one stage with the expected load
+                duration := plannedDuration(info)
+                if duration <= 0 {
+                        duration = span
+                }
+                stages = []plannedStage{{name: "whole test", duration: duration, targetRPS: plannedRPS(info)}}
+        }
+
+        for i, stage := range stages {
+                stageIntervals := intervalsInWindow(intervals, origin.Add(stage.offset), origin.Add(stage.offset+stage.duration))
+                result, findings := evaluateStage(stage, stageIntervals, previousTarget(stages, i))
+                conformance.Stages = append(conformance.Stages, result)
+                conformance.Findings = append(conformance.Findings, findings...)
+        }
+
+        if saturation := detectSaturation(intervals); saturation != nil {
+                for _, stage := range stages {
+                        start := origin.Add(stage.offset)
+                        if !saturation.at.Before(start) && saturation.at.Before(start.Add(stage.duration)) {
+                                saturation.point.Stage = stage.name
+                                break
+                        }
+                }
+                conformance.Saturation = &saturation.point
+                conformance.Findings = append(conformance.Findings, models.LoadProfileFinding{
+                        Type:   models.FindingSaturation,
+                        Stage:  saturation.point.Stage,
+                        Detail: saturation.point.Detail,
+                })
+        }
+
+        conformance.Conforms = len(conformance.Findings) == 0
+        switch {
+        case !complete:
+                conformance.Detail = "Some stages have no valid duration, the profile was compared up to the first such stage"
+        case conformance.Conforms:
+                conformance.Detail = "The achieved load follows the declared profile"
+        default:
+                conformance.Detail = fmt.Sprintf("The achieved load diverges from the declared profile: %d findings", len(conformance.Findings))
+        }
+
+        return conformance
+}
+
+// plannedStages lays the declared stages out one after another. Stages after one
+// without a valid duration cannot be placed, so the second result reports whether all were.
+func plannedStages(info models.ProjectInfo) ([]plannedStage, bool) {
+        var stages []plannedStage
+        var offset time.Duration
+        for i, stage := range info.Stages {
+                duration, err := ParseDurationValue(stage.Duration)
+                if err != nil || duration <= 0 {
+                        return stages, false
+                }
+                name := stage.Name
+                if name == "" {
+                        name = fmt.Sprintf("#%d", i+1)
+                }
+                stages = append(stages, plannedStage{
+                        name:      name,
+                        offset:    offset,
+                        duration:  duration,
+                        targetRPS: stage.TargetRPS,
+                        targetVUs: stage.TargetVUs,
+                })
+                offset += duration
+        }
+        return stages, true
+}
+
+// previousTarget returns the RPS target the stage starts from; a stage that keeps it is a steady one
+func previousTarget(stages []plannedStage, i int) float64 {
+        if i == 0 {
+                return -1
+        }
+        return stages[i-1].targetRPS
+}
+
+// intervalsInWindow selects the intervals whose midpoint falls into [start, end)
+func intervalsInWindow(intervals []models.MetricInterval, start, end time.Time) []models.MetricInterval {
+        var selected []models.MetricInterval
+        for _, interval := range intervals {
+                mid := interval.Start.Add(time.Duration(interval.DurationSeconds * float64(time.Second) / 2))
+                if !mid.Before(start) && mid.Before(end) {
+                        selected = append(selected, interval)
+                }
+        }
+        return selected
+}
+
+func evaluateStage(stage plannedStage, intervals []models.MetricInterval, startTarget float64) (models.StageConformance, []models.LoadProfileFinding) {
+        result := models.StageConformance{
+                Name:               stage.name,
+                StartOffsetSeconds: stage.offset.Seconds(),
+                DurationSeconds:    stage.duration.Seconds(),
+                TargetRPS:          stage.targetRPS,
+                TargetVUs:          stage.targetVUs,
+                Intervals:          len(intervals),
+                Status:             "conforms",
+        }
+        var findings []models.LoadProfileFinding
+
+        if len(intervals) == 0 {
+                result.Status = "not_run"
+                findings = append(findings, models.LoadProfileFinding{
+                        Type:   models.FindingStageNotRun,
+                        Stage:  stage.name,
+                        Detail: fmt.Sprintf("Stage %s has no metrics, the test ended before it", stage.name),
+                })
+                return result, findings
+        }
+
+        var rpsSum float64
+        var rpsCount, requests, errors int
+        for _, interval := range intervals {
+                if interval.RPS != nil {
+                        rpsSum += *interval.RPS
+                        rpsCount++
+                        if result.PeakRPS == nil || *interval.RPS > *result.PeakRPS {
+                                peak := *interval.RPS
+                                result.PeakRPS = &peak
+                        }
+                }
+                if interval.ActiveVUs != nil && (result.PeakVUs == nil || *interval.ActiveVUs > *result.PeakVUs) {
+                        peak := *interval.ActiveVUs
+                        result.PeakVUs = &peak
+                }
+                requests += interval.Requests
+                errors += interval.Errors
+        }
+        if rpsCount > 0 {
+                mean := rpsSum / float64(rpsCount)
+                result.MeanRPS = &mean
+        }
+        if requests > 0 {
+                rate := float64(errors) / float64(requests) * 100
+                result.ErrorRatePercent = &rate
+        }
+
+        if stage.targetRPS > 0 && result.PeakRPS != nil && *result.PeakRPS < stage.targetRPS*loadTolerance {
+                findings = append(findings, models.LoadProfileFinding{
+                        Type:  models.FindingTargetRPSNotReached,
+                        Stage: stage.name,
+                        Detail: fmt.Sprintf("Stage %s peaked at %.1f RPS, the target was %.1f RPS",
+                                stage.name, *result.PeakRPS, stage.targetRPS),
+                })
+        }
+        if stage.targetVUs > 0 && result.PeakVUs != nil && float64(*result.PeakVUs) < float64(stage.targetVUs)*loadTolerance {
+                findings = append(findings, models.LoadProfileFinding{
+                        Type:  models.FindingTargetVUsNotReached,
+                        Stage: stage.name,
+                        Detail: fmt.Sprintf("Stage %s peaked at %d virtual users, the target was %d",
+                                stage.name, *result.PeakVUs, stage.targetVUs),
+                })
+        }
+
+        // Latency that grows while throughput does not is degradation, not the cost of more load
+        if len(intervals) >= 3 {
+                third := len(intervals) / 3
+                head, tail := intervals[:third], intervals[len(intervals)-third:]
+                result.P95Start = meanIntervalValue(head, func(i models.MetricInterval) *float64 { return i.P95 })
+                result.P95End = meanIntervalValue(tail, func(i models.MetricInterval) *float64 { return i.P95 })
+                rpsStart := meanIntervalValue(head, func(i models.MetricInterval) *float64 { return i.RPS })
+                rpsEnd := meanIntervalValue(tail, func(i models.MetricInterval) *float64 { return i.RPS })
+
+                steady := startTarget < 0 || startTarget == stage.targetRPS
+                noMoreLoad := rpsStart != nil && rpsEnd != nil && *rpsEnd <= *rpsStart*1.1
+                if result.P95Start != nil && result.P95End != nil && *result.P95Start > 0 &&
+                        *result.P95End > *result.P95Start*latencyDegradationFactor && (steady || noMoreLoad) {
+                        findings = append(findings, models.LoadProfileFinding{
+                                Type:  models.FindingLatencyDegradation,
+                                Stage: stage.name,
+                                Detail: fmt.Sprintf("p95 grew from %.1f ms to %.1f ms during stage %s without a matching growth in throughput",
+                                        *result.P95Start, *result.P95End, stage.name),
+                        })
+                }
+        }
+
+        if len(findings) > 0 {
+                result.Status = "diverges"
+        }
+        return result, findings
+}
+
+func meanIntervalValue(intervals []models.MetricInterval, value func(models.MetricInterval) *float64) *float64 {
+        var sum float64
+        count := 0
+        for _, interval := range intervals {
+                if v := value(interval); v != nil {
+                        sum += *v
+                        count++
+                }
+        }
+        if count == 0 {
+                return nil
+        }
+        mean := sum / float64(count)
+        return &mean
+}
+
+// saturationResult is a saturation point with the time it was first reached
+type saturationResult struct {
+        point models.SaturationPoint
+        at    time.Time
+}
+
+// detectSaturation averages throughput per VU level and finds the first level after which
+// adding 20% more users added less than 5% throughput
+func detectSaturation(intervals []models.MetricInterval) *saturationResult {
+        type level struct {
+                vus   int
+                rps   float64
+                count int
+                first time.Time
+        }
+        byVUs := make(map[int]*level)
+        for _, interval := range intervals {
+                if interval.ActiveVUs == nil || interval.RPS == nil || *interval.ActiveVUs == 0 {
+                        continue
+                }
+                l, ok := byVUs[*interval.ActiveVUs]
+                if !ok {
+                        l = &level{vus: *interval.ActiveVUs, first: interval.Start}
+                        byVUs[*interval.ActiveVUs] = l
+                }
+                l.rps += *interval.RPS
+                l.count++
+        }
+        if len(byVUs) < 3 {
+                return nil
+        }
+
+        levels := make([]*level, 0, len(byVUs))
+        for _, l := range byVUs {
+                l.rps /= float64(l.count)
+                levels = append(levels, l)
+        }
+        sort.Slice(levels, func(i, j int) bool { return levels[i].vus < levels[j].vus })
+
+        for i, current := range levels {
+                // The closest lower level with at least 20% fewer users
+                var lower *level
+                for j := i - 1; j >= 0; j-- {
+                        if float64(levels[j].vus)*saturationVUGrowth <= float64(current.vus) {
+                                lower = levels[j]
+                                break
+                        }
+                }
+                if lower == nil || current.rps >= lower.rps*saturationRPSGrowth {
+                        continue
+                }
+                return &saturationResult{
+                        at: lower.first,
+                        point: models.SaturationPoint{
+                                VUs: lower.vus,
+                                RPS: lower.rps,
+                                Detail: fmt.Sprintf("Throughput stopped growing at about %d virtual users (%.1f RPS): %d users gave %.1f RPS",
+                                        lower.vus, lower.rps, current.vus, current.rps),
+                        },
+                }
+        }
+        return nil
+}
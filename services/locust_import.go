@@ -0,0 +1,253 @@
+package services
+
+import (
+        "encoding/csv"
+        "encoding/json"
+        "fmt"
+        "io"
+        "sort"
+        "strconv"
+        "strings"
+        "time"
+
+        "github.com/performance-analyzer/models"
+)
+
+func init() {
+        RegisterResultsParser("locust", ResultsParserFunc(ParseLocustResults))
+}
+
+// locustAggregated is the name of the run-wide row in Locust CSV files
+const locustAggregated = "Aggregated"
+
+// locustHistoryPoint is one Aggregated row of stats_history.csv
+type locustHistoryPoint struct {
+        Timestamp     int64
+        Users         int
+        RPS           *float64
+        P50           *float64
+        P95           *float64
+        TotalRequests int
+        TotalFailures int
+}
+
+// ParseLocustResults reads a Locust --csv file: <prefix>_stats.csv or <prefix>_stats_history.csv.
+// The file kind is recognized by its header.
+func ParseLocustResults(r io.Reader, project *models.Project) (*models.SendResultsRequest, error) {
+        reader := csv.NewReader(r)
+        reader.FieldsPerRecord = -1
+
+        header, err := reader.Read()
+        if err != nil {
+                return nil, fmt.Errorf("invalid Locust CSV: %w", err)
+        }
+        columns := make(map[string]int, len(header))
+        for i, name := range header {
+                columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+        }
+
+        var req *models.SendResultsRequest
+        file := "stats"
+        if _, ok := columns["Timestamp"]; ok {
+                file = "stats_history"
+                req, err = readLocustHistory(reader, columns)
+        } else {
+                req, err = readLocustStats(reader, columns)
+        }
+        if err != nil {
+                return nil, err
+        }
+
+        raw := map[string]interface{}{
+                "source":     "locust",
+                "csv_file":   file,
+                "assertions": evaluateImportedNFRs(project, req),
+        }
+        req.RawResults, _ = json.Marshal(raw)
+
+        return req, nil
+}
+
+// readLocustStats reads the end-of-test stats; the Aggregated row gives the run-wide totals
+func readLocustStats(reader *csv.Reader, columns map[string]int) (*models.SendResultsRequest, error) {
+        for _, required := range []string{"Name", "Request Count", "Failure Count"} {
+                if _, ok := columns[required]; !ok {
+                        return nil, fmt.Errorf("Locust stats CSV has no %q column", required)
+                }
+        }
+
+        req := &models.SendResultsRequest{}
+        aggregated := false
+        for {
+                record, err := reader.Read()
+                if err == io.EOF {
+                        break
+                }
+                if err != nil {
+                        return nil, fmt.Errorf("failed to read Locust stats CSV: %w", err)
+                }
+
+                row := locustRow{record: record, columns: columns}
+                requests := row.count("Request Count")
+                failures := row.count("Failure Count")
+
+                if row.text("Name") == locustAggregated {
+                        aggregated = true
+                        req.SuccessfulCalls = requests - failures
+                        req.FailedCalls = failures
+                        if rps := row.number("Requests/s"); rps != nil && *rps > 0 {
+                                req.AchievedRPS = rps
+                                // Locust computes Requests/s over the whole run, so the run length follows from it
+                                req.TestDuration, _ = json.Marshal(float64(requests) / *rps)
+                        }
+                        continue
+                }
+
+                endpoint := models.EndpointMetrics{
+                        Name:     row.text("Name"),
+                        P50:      row.number("50%"),
+                        P90:      row.number("90%"),
+                        P95:      row.number("95%"),
+                        P99:      row.number("99%"),
+                        Max:      row.number("Max Response Time"),
+                        RPS:      row.number("Requests/s"),
+                        Requests: requests,
+                        Errors:   failures,
+                }
+                if method := strings.ToUpper(row.text("Type")); httpMethods[method] {
+                        endpoint.Method = method
+                }
+                req.Endpoints = append(req.Endpoints, endpoint)
+        }
+
+        if !aggregated {
+                return nil, fmt.Errorf("Locust stats CSV has no %s row", locustAggregated)
+        }
+        return req, nil
+}
+
+// readLocustHistory reads stats_history.csv. Its percentiles cover a recent window only,
+// so endpoints get the final cumulative counts and maximum, and the Aggregated rows become
+// the time series of the run.
+func readLocustHistory(reader *csv.Reader, columns map[string]int) (*models.SendResultsRequest, error) {
+        history := []locustHistoryPoint{}
+        latest := make(map[string]locustRow)
+
+        for {
+                record, err := reader.Read()
+                if err == io.EOF {
+                        break
+                }
+                if err != nil {
+                        return nil, fmt.Errorf("failed to read Locust history CSV: %w", err)
+                }
+
+                row := locustRow{record: record, columns: columns}
+                name := row.text("Name")
+                latest[row.text("Type")+" "+name] = row
+
+                if name == locustAggregated {
+                        timestamp, _ := strconv.ParseInt(row.text("Timestamp"), 10, 64)
+                        history = append(history, locustHistoryPoint{
+                                Timestamp:     timestamp,
+                                Users:         row.count("User Count"),
+                                RPS:           row.number("Requests/s"),
+                                P50:           row.number("50%"),
+                                P95:           row.number("95%"),
+                                TotalRequests: row.count("Total Request Count"),
+                                TotalFailures: row.count("Total Failure Count"),
+                        })
+                }
+        }
+
+        if len(history) == 0 {
+                return nil, fmt.Errorf("Locust history CSV has no %s rows", locustAggregated)
+        }
+
+        last := history[len(history)-1]
+        req := &models.SendResultsRequest{
+                SuccessfulCalls: last.TotalRequests - last.TotalFailures,
+                FailedCalls:     last.TotalFailures,
+        }
+        if seconds := float64(last.Timestamp - history[0].Timestamp); seconds > 0 {
+                req.TestDuration, _ = json.Marshal(seconds)
+                rps := float64(last.TotalRequests) / seconds
+                req.AchievedRPS = &rps
+        }
+        req.Intervals = locustIntervals(history)
+
+        // Per-endpoint rows are present only with --csv-full-history
+        for _, row := range latest {
+                if row.text("Name") == locustAggregated {
+                        continue
+                }
+                endpoint := models.EndpointMetrics{
+                        Name:     row.text("Name"),
+                        Max:      row.number("Total Max Response Time"),
+                        Requests: row.count("Total Request Count"),
+                        Errors:   row.count("Total Failure Count"),
+                }
+                if method := strings.ToUpper(row.text("Type")); httpMethods[method] {
+                        endpoint.Method = method
+                }
+                req.Endpoints = append(req.Endpoints, endpoint)
+        }
+        sort.Slice(req.Endpoints, func(i, j int) bool {
+                return EndpointLabel(req.Endpoints[i]) < EndpointLabel(req.Endpoints[j])
+        })
+
+        return req, nil
+}
+
+// locustIntervals turns consecutive history rows into intervals; each row closes the
+// interval that started at the previous one
+func locustIntervals(history []locustHistoryPoint) []models.MetricInterval {
+        intervals := []models.MetricInterval{}
+        for i := 1; i < len(history); i++ {
+                previous, point := history[i-1], history[i]
+                seconds := float64(point.Timestamp - previous.Timestamp)
+                if seconds <= 0 {
+                        continue
+                }
+                users := point.Users
+                intervals = append(intervals, models.MetricInterval{
+                        Start:           time.Unix(previous.Timestamp, 0).UTC(),
+                        DurationSeconds: seconds,
+                        RPS:             point.RPS,
+                        ActiveVUs:       &users,
+                        P50:             point.P50,
+                        P95:             point.P95,
+                        Requests:        max(point.TotalRequests-previous.TotalRequests, 0),
+                        Errors:          max(point.TotalFailures-previous.TotalFailures, 0),
+                })
+        }
+        return intervals
+}
+
+// locustRow reads CSV columns by name; Locust writes "N/A" for values it could not compute
+type locustRow struct {
+        record  []string
+        columns map[string]int
+}
+
+func (r locustRow) text(name string) string {
+        if i, ok := r.columns[name]; ok && i < len(r.record) {
+                return strings.TrimSpace(r.record[i])
+        }
+        return ""
+}
+
+func (r locustRow) number(name string) *float64 {
+        value, err := strconv.ParseFloat(r.text(name), 64)
+        if err != nil {
+                return nil
+        }
+        return &value
+}
+
+func (r locustRow) count(name string) int {
+        if value := r.number(name); value != nil {
+                return int(*value)
+        }
+        return 0
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+        "encoding/json"
+        "fmt"
+        "math"
+        "regexp"
+        "sort"
+        "strconv"
+        "strings"
+
+        "github.com/performance-analyzer/models"
+)
+
+// NFR metrics understood by the evaluator
+const (
+        metricErrorRate  = "error_rate"
+        metricThroughput = "throughput"
+)
+
+var latencyMetrics = map[string]bool{"p50": true, "p90": true, "p95": true, "p99": true, "max": true}
+
+// nfrPattern matches requirements like "p95 < 300ms for GET /items", "error rate < 1%" or "throughput >= 500 RPS"
+var nfrPattern = regexp.MustCompile(`(?i)^\s*(p\d{2}|median|max|error[ _-]?rate|errors|throughput|rps)\s*(<=|>=|==|=|<|>|≤|≥)\s*([0-9]+(?:[.,][0-9]+)?)\s*(ms|msec|s|sec|%|rps|req/s)?\s*(?:(?:for|on|для)\s+(.+?))?\s*$`)
+
+// resultTotals is the run-wide view of the results used by run-wide requirements
+type resultTotals struct {
+        successful int
+        failed     int
+        rps        float64
+}
+
+// ParseNFRRules reads nonfunctional requirements given as a list of strings, a list of
+// rule objects, a single string with one requirement per line, or a map of well-known keys.
+// Requirements that cannot be understood are returned separately so they can be reported.
+func ParseNFRRules(raw json.RawMessage) ([]models.NFRRule, []string) {
+        if len(raw) == 0 || string(raw) == "null" {
+                return nil, nil
+        }
+
+        var rules []models.NFRRule
+        var unparsed []string
+
+        addText := func(text string) {
+                for _, line := range strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == ';' }) {
+                        if strings.TrimSpace(line) == "" {
+                                continue
+                        }
+                        if rule, ok := parseNFRText(line); ok {
+                                rules = append(rules, rule)
+                        } else {
+                                unparsed = append(unparsed, strings.TrimSpace(line))
+                        }
+                }
+        }
+
+        var text string
+        if json.Unmarshal(raw, &text) == nil {
+                addText(text)
+                return rules, unparsed
+        }
+
+        var items []json.RawMessage
+        if json.Unmarshal(raw, &items) == nil {
+                for _, item := range items {
+                        if json.Unmarshal(item, &text) == nil {
+                                addText(text)
+                                continue
+                        }
+                        var rule models.NFRRule
+                        if json.Unmarshal(item, &rule) == nil {
+                                if normalized, ok := normalizeNFRRule(rule); ok {
+                                        rules = append(rules, normalized)
+                                        continue
+                                }
+                        }
+                        unparsed = append(unparsed, string(item))
+                }
+                return rules, unparsed
+        }
+
+        var keyed map[string]json.RawMessage
+        if json.Unmarshal(raw, &keyed) == nil {
+                keys := make([]string, 0, len(keyed))
+                for key := range keyed {
+                        keys = append(keys, key)
+                }
+                sort.Strings(keys)
+                for _, key := range keys {
+                        if rule, ok := parseNFRKey(key, keyed[key]); ok {
+                                rules = append(rules, rule)
+                        } else if json.Unmarshal(keyed[key], &text) == nil {
+                                addText(text)
+                        } else {
+                                unparsed = append(unparsed, fmt.Sprintf("%s: %s", key, string(keyed[key])))
+                        }
+                }
+                return rules, unparsed
+        }
+
+        return nil, []string{string(raw)}
+}
+
+func parseNFRText(text string) (models.NFRRule, bool) {
+        match := nfrPattern.FindStringSubmatch(text)
+        if match == nil {
+                return models.NFRRule{}, false
+        }
+
+        threshold, err := strconv.ParseFloat(strings.ReplaceAll(match[3], ",", "."), 64)
+        if err != nil {
+                return models.NFRRule{}, false
+        }
+
+        return normalizeNFRRule(models.NFRRule{
+                Requirement: strings.TrimSpace(text),
+                Metric:      match[1],
+                Operator:    match[2],
+                Threshold:   threshold,
+                Unit:        match[4],
+                Endpoint:    strings.TrimSpace(match[5]),
+        })
+}
+
+// parseNFRKey understands the keys clients already send, e.g. {"max_response_time_ms": 500}
+func parseNFRKey(key string, raw json.RawMessage) (models.NFRRule, bool) {
+        var value float64
+        if json.Unmarshal(raw, &value) != nil {
+                return models.NFRRule{}, false
+        }
+
+        rule := models.NFRRule{Requirement: fmt.Sprintf("%s: %g", key, value), Threshold: value}
+        switch strings.ToLower(key) {
+        case "max_response_time_ms":
+                rule.Metric, rule.Operator, rule.Unit = "max", "<=", "ms"
+        case "p95_ms", "response_time_p95_ms":
+                rule.Metric, rule.Operator, rule.Unit = "p95", "<=", "ms"
+        case "p90_ms":
+                rule.Metric, rule.Operator, rule.Unit = "p90", "<=", "ms"
+        case "p99_ms", "response_time_p99_ms":
+                rule.Metric, rule.Operator, rule.Unit = "p99", "<=", "ms"
+        case "target_throughput_rps", "min_throughput_rps":
+                rule.Metric, rule.Operator, rule.Unit = metricThroughput, ">=", "rps"
+        case "target_error_rate_percent", "max_error_rate_percent":
+                rule.Metric, rule.Operator, rule.Unit = metricErrorRate, "<=", "%"
+        default:
+                return models.NFRRule{}, false
+        }
+        return rule, true
+}
+
+// normalizeNFRRule canonicalizes metric names, operators and units (latency in ms, error rate in %)
+func normalizeNFRRule(rule models.NFRRule) (models.NFRRule, bool) {
+        metric := strings.ToLower(strings.TrimSpace(rule.Metric))
+        switch {
+        case metric == "median":
+                metric = "p50"
+        case strings.HasPrefix(metric, "error"):
+                metric = metricErrorRate
+        case metric == "rps":
+                metric = metricThroughput
+        }
+        if !latencyMetrics[metric] && metric != metricErrorRate && metric != metricThroughput {
+                return rule, false
+        }
+        rule.Metric = metric
+
+        switch rule.Operator {
+        case "≤":
+                rule.Operator = "<="
+        case "≥":
+                rule.Operator = ">="
+        case "=":
+                rule.Operator = "=="
+        case "<", "<=", ">", ">=", "==":
+        default:
+                return rule, false
+        }
+
+        unit := strings.ToLower(strings.TrimSpace(rule.Unit))
+        switch metric {
+        case metricErrorRate:
+                // A unitless "error rate < 0.5" reads as a fraction or as percent equally well,
+                // so error rates must be given in percent
+                if unit != "%" && unit != "percent" {
+                        return rule, false
+                }
+                rule.Unit = "%"
+        case metricThroughput:
+                rule.Unit = "rps"
+        default:
+                if unit == "s" || unit == "sec" {
+                        rule.Threshold *= 1000
+                }
+                rule.Unit = "ms"
+        }
+
+        if rule.Requirement == "" {
+                rule.Requirement = strings.TrimSpace(fmt.Sprintf("%s %s %g%s %s", rule.Metric, rule.Operator, rule.Threshold, rule.Unit, rule.Endpoint))
+        }
+        return rule, true
+}
+
+// evaluateNFRs checks every rule against the submitted metrics. Run-wide latency rules are
+// checked against the worst endpoint, so "p95 < 300ms" holds only if it holds for every endpoint.
+func evaluateNFRs(rules []models.NFRRule, unparsed []string, endpoints []models.EndpointMetrics, totals resultTotals) []models.NFRResult {
+        results := make([]models.NFRResult, 0, len(rules)+len(unparsed))
+
+        for _, rule := range rules {
+                result := models.NFRResult{
+                        Requirement: rule.Requirement,
+                        Metric:      rule.Metric,
+                        Endpoint:    rule.Endpoint,
+                        Operator:    rule.Operator,
+                        Threshold:   rule.Threshold,
+                        Unit:        rule.Unit,
+                }
+
+                actual, source := actualNFRValue(rule, endpoints, totals)
+                if actual == nil {
+                        result.Status = models.NFRUnknown
+                        result.Detail = source
+                        results = append(results, result)
+                        continue
+                }
+
+                result.Actual = actual
+                if compareNFR(*actual, rule.Operator, rule.Threshold) {
+                        result.Status = models.NFRPass
+                } else {
+                        result.Status = models.NFRFail
+                }
+                result.Detail = source
+                results = append(results, result)
+        }
+
+        for _, text := range unparsed {
+                results = append(results, models.NFRResult{
+                        Requirement: text,
+                        Status:      models.NFRUnknown,
+                        Detail:      "Requirement could not be parsed",
+                })
+        }
+
+        return results
+}
+
+// actualNFRValue finds the measured value for a rule and describes where it came from
+func actualNFRValue(rule models.NFRRule, endpoints []models.EndpointMetrics, totals resultTotals) (*float64, string) {
+        if rule.Endpoint != "" {
+                endpoint, ok := findEndpoint(endpoints, rule.Endpoint)
+                if !ok {
+                        return nil, fmt.Sprintf("No metrics reported for %s", rule.Endpoint)
+                }
+                value := endpointMetricValue(endpoint, rule.Metric)
+                if value == nil {
+                        return nil, fmt.Sprintf("%s is not reported for %s", rule.Metric, EndpointLabel(endpoint))
+                }
+                return value, EndpointLabel(endpoint)
+        }
+
+        switch rule.Metric {
+        case metricErrorRate:
+                total := totals.successful + totals.failed
+                if total == 0 {
+                        return nil, "No requests to compute the error rate from"
+                }
+                value := float64(totals.failed) / float64(total) * 100
+                return &value, "all requests"
+        case metricThroughput:
+                if totals.rps > 0 {
+                        value := totals.rps
+                        return &value, "whole test"
+                }
+                var sum float64
+                found := false
+                for _, endpoint := range endpoints {
+                        if endpoint.RPS != nil {
+                                sum += *endpoint.RPS
+                                found = true
+                        }
+                }
+                if !found {
+                        return nil, "Throughput is not reported"
+                }
+                return &sum, "sum of endpoints"
+        }
+
+        // Latency: the worst endpoint decides
+        var worst *float64
+        worstLabel := ""
+        for _, endpoint := range endpoints {
+                value := endpointMetricValue(endpoint, rule.Metric)
+                if value != nil && (worst == nil || *value > *worst) {
+                        worst = value
+                        worstLabel = EndpointLabel(endpoint)
+                }
+        }
+        if worst == nil {
+                return nil, fmt.Sprintf("%s is not reported for any endpoint", rule.Metric)
+        }
+        return worst, fmt.Sprintf("worst endpoint: %s", worstLabel)
+}
+
+func endpointMetricValue(endpoint models.EndpointMetrics, metric string) *float64 {
+        switch metric {
+        case "p50":
+                return endpoint.P50
+        case "p90":
+                return endpoint.P90
+        case "p95":
+                return endpoint.P95
+        case "p99":
+                return endpoint.P99
+        case "max":
+                return endpoint.Max
+        case metricThroughput:
+                return endpoint.RPS
+        case metricErrorRate:
+                if endpoint.Requests == 0 {
+                        return nil
+                }
+                value := float64(endpoint.Errors) / float64(endpoint.Requests) * 100
+                return &value
+        }
+        return nil
+}
+
+// findEndpoint matches "GET /items" exactly, or "/items" when only one method serves it
+func findEndpoint(endpoints []models.EndpointMetrics, label string) (models.EndpointMetrics, bool) {
+        method, name := splitEndpointKey(label)
+        var candidates []models.EndpointMetrics
+        for _, endpoint := range endpoints {
+                if !strings.EqualFold(endpoint.Name, name) {
+                        continue
+                }
+                if method == "" || endpoint.Method == "" || endpoint.Method == method {
+                        candidates = append(candidates, endpoint)
+                }
+        }
+        if len(candidates) != 1 {
+                for _, endpoint := range candidates {
+                        if endpoint.Method == method {
+                                return endpoint, true
+                        }
+                }
+                return models.EndpointMetrics{}, false
+        }
+        return candidates[0], true
+}
+
+func compareNFR(actual float64, operator string, threshold float64) bool {
+        switch operator {
+        case "<":
+                return actual < threshold
+        case "<=":
+                return actual <= threshold
+        case ">":
+                return actual > threshold
+        case ">=":
+                return actual >= threshold
+        default:
+                return math.Abs(actual-threshold) < 1e-9
+        }
+}
+
+// summarizeNFRResults counts results by status
+func summarizeNFRResults(results []models.NFRResult) map[string]int {
+        summary := map[string]int{models.NFRPass: 0, models.NFRFail: 0, models.NFRUnknown: 0}
+        for _, result := range results {
+                summary[result.Status]++
+        }
+        return summary
+}
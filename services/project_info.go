@@ -0,0 +1,161 @@
+package services
+
+import (
+        "encoding/json"
+        "fmt"
+        "regexp"
+        "strconv"
+        "strings"
+        "time"
+
+        "github.com/performance-analyzer/models"
+)
+
+var numberPattern = regexp.MustCompile(`[0-9]+(?:[.,][0-9]+)?`)
+
+// parseProjectInfo reads the typed test parameters from project_info.
+// Malformed or free-form project_info yields an empty ProjectInfo rather than an error.
+func parseProjectInfo(raw json.RawMessage) models.ProjectInfo {
+        info, _ := parseProjectInfoFields(raw)
+        return info
+}
+
+// parseProjectInfoFields reads project_info field by field, so a mistyped field loses only
+// itself. It returns the names of the fields that were present but could not be read.
+func parseProjectInfoFields(raw json.RawMessage) (models.ProjectInfo, []string) {
+        var info models.ProjectInfo
+        var loose map[string]json.RawMessage
+        if len(raw) == 0 || json.Unmarshal(raw, &loose) != nil {
+                return info, nil
+        }
+
+        fields := []struct {
+                name   string
+                decode func(json.RawMessage) error
+        }{
+                {"stand", func(v json.RawMessage) error { return decodeField(v, &info.Stand) }},
+                {"expected_load", func(v json.RawMessage) error { return decodeField(v, &info.ExpectedLoad) }},
+                {"expected_rps", func(v json.RawMessage) error { return decodeField(v, &info.ExpectedRPS) }},
+                {"duration", func(v json.RawMessage) error { return decodeField(v, &info.Duration) }},
+                {"stages", func(v json.RawMessage) error { return decodeField(v, &info.Stages) }},
+                {"load_profile", func(v json.RawMessage) error { return decodeField(v, &info.LoadProfile) }},
+                {"max_error_rate_percent", func(v json.RawMessage) error { return decodeField(v, &info.MaxErrorRatePercent) }},
+                {"nonfunctional_requirements", func(v json.RawMessage) error { return decodeField(v, &info.NonfunctionalRequirements) }},
+        }
+
+        var ignored []string
+        for _, field := range fields {
+                value, ok := loose[field.name]
+                if !ok || string(value) == "null" {
+                        continue
+                }
+                if err := field.decode(value); err != nil {
+                        ignored = append(ignored, field.name)
+                }
+        }
+        return info, ignored
+}
+
+// decodeField decodes value into target, leaving target untouched when value does not fit it
+func decodeField[T any](value json.RawMessage, target *T) error {
+        var decoded T
+        if err := json.Unmarshal(value, &decoded); err != nil {
+                return err
+        }
+        *target = decoded
+        return nil
+}
+
+// plannedRPS returns the target throughput of the test, or 0 when it was not specified
+func plannedRPS(info models.ProjectInfo) float64 {
+        if info.ExpectedRPS > 0 {
+                return info.ExpectedRPS
+        }
+
+        if rps := parseRPSValue(info.ExpectedLoad); rps > 0 {
+                return rps
+        }
+
+        var maxStageRPS float64
+        for _, stage := range info.Stages {
+                if stage.TargetRPS > maxStageRPS {
+                        maxStageRPS = stage.TargetRPS
+                }
+        }
+        return maxStageRPS
+}
+
+// plannedDuration returns the planned test length: the explicit duration or the sum of the stages
+func plannedDuration(info models.ProjectInfo) time.Duration {
+        if d, err := ParseDurationValue(info.Duration); err == nil && d > 0 {
+                return d
+        }
+
+        var total time.Duration
+        for _, stage := range info.Stages {
+                if d, err := ParseDurationValue(stage.Duration); err == nil {
+                        total += d
+                }
+        }
+        return total
+}
+
+// parseRPSValue reads expected load given as a number or as text like "1000 RPS"
+func parseRPSValue(raw json.RawMessage) float64 {
+        if len(raw) == 0 {
+                return 0
+        }
+
+        var number float64
+        if json.Unmarshal(raw, &number) == nil {
+                return number
+        }
+
+        var text string
+        if json.Unmarshal(raw, &text) != nil {
+                return 0
+        }
+        lower := strings.ToLower(text)
+        if !strings.Contains(lower, "rps") && !strings.Contains(lower, "req/s") && !strings.Contains(lower, "запрос") {
+                return 0
+        }
+        match := numberPattern.FindString(lower)
+        if match == "" {
+                return 0
+        }
+        value, _ := strconv.ParseFloat(strings.ReplaceAll(match, ",", "."), 64)
+        return value
+}
+
+// ParseDurationValue reads a duration given as a Go duration string ("10m", "1h30m"),
+// as a number of seconds, or as a string holding a number of seconds
+func ParseDurationValue(raw json.RawMessage) (time.Duration, error) {
+        if len(raw) == 0 || string(raw) == "null" {
+                return 0, fmt.Errorf("duration is not set")
+        }
+
+        var seconds float64
+        if err := json.Unmarshal(raw, &seconds); err == nil {
+                if seconds < 0 {
+                        return 0, fmt.Errorf("duration cannot be negative")
+                }
+                return time.Duration(seconds * float64(time.Second)), nil
+        }
+
+        var text string
+        if err := json.Unmarshal(raw, &text); err != nil {
+                return 0, fmt.Errorf("duration must be a number of seconds or a string like \"10m\"")
+        }
+        text = strings.TrimSpace(text)
+        if value, err := strconv.ParseFloat(text, 64); err == nil && value >= 0 {
+                return time.Duration(value * float64(time.Second)), nil
+        }
+        d, err := time.ParseDuration(text)
+        if err != nil {
+                return 0, fmt.Errorf("invalid duration %q", text)
+        }
+        if d < 0 {
+                return 0, fmt.Errorf("duration cannot be negative")
+        }
+        return d, nil
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+        "context"
+        "errors"
+        "fmt"
+        "log"
+
+        "github.com/google/uuid"
+        "github.com/jackc/pgx/v5"
+        "github.com/jackc/pgx/v5/pgconn"
+        "github.com/performance-analyzer/models"
+)
+
+// projectReadyCondition selects the collecting projects whose test results arrived and whose
+// files are all received and analysed
+const projectReadyCondition = `
+        p.status = 'collecting' AND p.has_test_results AND p.received_files_count >= p.files_count
+        AND NOT EXISTS (
+            SELECT 1 FROM project_files f
+            WHERE f.project_uuid = p.uuid AND f.analysis_status IN ('queued', 'analyzing'))`
+
+// StateError is returned when the state of the project does not allow the action
+type StateError struct {
+        Action string
+        State  models.ProjectState
+}
+
+func (e *StateError) Error() string {
+        return fmt.Sprintf("cannot %s: project is %s", e.Action, e.State)
+}
+
+// dbExecutor is what project transitions need of the pool or of a transaction
+type dbExecutor interface {
+        Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+        QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// transitionProject moves the project to the next state. The allowed source states are part
+// of the UPDATE, so of concurrent callers only those the current state allows succeed; the
+// others get a *StateError with the state the project is in.
+func (a *Analyzer) transitionProject(ctx context.Context, db dbExecutor, projectUUID uuid.UUID, next models.ProjectState) error {
+        var from []string
+        for _, state := range models.ProjectStatesBefore(next) {
+                from = append(from, string(state))
+        }
+
+        tag, err := db.Exec(ctx,
+                `UPDATE projects SET status = $1, updated_at = CURRENT_TIMESTAMP
+                 WHERE uuid = $2 AND status = ANY($3)`,
+                string(next), projectUUID, from)
+        if err != nil {
+                return fmt.Errorf("failed to move project to %s: %w", next, err)
+        }
+        if tag.RowsAffected() > 0 {
+                return nil
+        }
+
+        var state models.ProjectState
+        if err := db.QueryRow(ctx, "SELECT status FROM projects WHERE uuid = $1", projectUUID).Scan(&state); err != nil {
+                return err
+        }
+        return &StateError{Action: "move to " + string(next), State: state}
+}
+
+// markProjectReady moves a collecting project to ready once everything for the final analysis
+// is in. It reports whether this call made the move, so only one caller queues the analysis.
+func (a *Analyzer) markProjectReady(ctx context.Context, projectUUID uuid.UUID) (bool, error) {
+        tag, err := a.db.Exec(ctx,
+                `UPDATE projects p SET status = 'ready', updated_at = CURRENT_TIMESTAMP
+                 WHERE p.uuid = $1 AND `+projectReadyCondition, projectUUID)
+        if err != nil {
+                return false, fmt.Errorf("failed to check analysis readiness: %w", err)
+        }
+        return tag.RowsAffected() > 0, nil
+}
+
+// LockCollectingProject locks the project row for the transaction and checks that the project
+// still accepts files and test results. While the lock is held the project cannot become
+// ready, so nothing is added to a project whose final analysis is already queued.
+func (a *Analyzer) LockCollectingProject(ctx context.Context, tx pgx.Tx, projectUUID uuid.UUID, action string) error {
+        var state models.ProjectState
+        err := tx.QueryRow(ctx, "SELECT status FROM projects WHERE uuid = $1 FOR UPDATE", projectUUID).Scan(&state)
+        if err != nil {
+                return err
+        }
+        if state != models.ProjectCollecting {
+                return &StateError{Action: action, State: state}
+        }
+        return nil
+}
+
+// GetProjectState returns the state the project is in
+func (a *Analyzer) GetProjectState(ctx context.Context, projectUUID uuid.UUID) (models.ProjectState, error) {
+        var state models.ProjectState
+        err := a.db.QueryRow(ctx, "SELECT status FROM projects WHERE uuid = $1", projectUUID).Scan(&state)
+        return state, err
+}
+
+// CancelProject stops a project that has not finished: it accepts no more uploads, and its
+// waiting jobs are dropped. A job already running notices the cancellation when it tries to
+// move the project on and discards its result.
+func (a *Analyzer) CancelProject(ctx context.Context, projectUUID uuid.UUID) error {
+        tx, err := a.db.Begin(ctx)
+        if err != nil {
+                return err
+        }
+        defer tx.Rollback(ctx)
+
+        if err := a.transitionProject(ctx, tx, projectUUID, models.ProjectCancelled); err != nil {
+                return err
+        }
+
+        tag, err := tx.Exec(ctx,
+                `UPDATE jobs SET status = 'failed', last_error = 'project cancelled', updated_at = CURRENT_TIMESTAMP
+                 WHERE project_uuid = $1 AND status = 'queued'`, projectUUID)
+        if err != nil {
+                return fmt.Errorf("failed to drop queued jobs: %w", err)
+        }
+
+        if err := tx.Commit(ctx); err != nil {
+                return err
+        }
+        log.Printf("Cancelled project %s, dropped %d queued jobs", projectUUID, tag.RowsAffected())
+        return nil
+}
+
+// isProjectState tells whether err is a *StateError for a project already in the given state
+func isProjectState(err error, state models.ProjectState) bool {
+        var stateErr *StateError
+        return errors.As(err, &stateErr) && stateErr.State == state
+}
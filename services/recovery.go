@@ -0,0 +1,81 @@
+package services
+
+import (
+        "context"
+        "fmt"
+        "log"
+
+        "github.com/performance-analyzer/models"
+)
+
+// RecoverJobs queues again the work a crash or a lost enqueue left behind: final analyses of
+// projects that are ready or stuck in analyzing, including collecting projects that became
+// complete without being moved to ready, and input reviews and file analyses that never
+// finished. Work with a queued or running job is left alone; a running job whose worker died
+// is taken over by Claim once its lease expires, so live workers on other instances are not
+// hijacked.
+func (a *Analyzer) RecoverJobs(ctx context.Context) (int, error) {
+        _, err := a.db.Exec(ctx, `
+                UPDATE projects p SET status = 'ready', updated_at = CURRENT_TIMESTAMP
+                WHERE `+projectReadyCondition)
+        if err != nil {
+                return 0, fmt.Errorf("failed to recover ready projects: %w", err)
+        }
+
+        analyses, err := a.requeueStale(ctx, models.JobKindFinalAnalysis, `
+                SELECT p.uuid
+                FROM projects p
+                WHERE p.status IN ('ready', 'analyzing')`)
+        if err != nil {
+                return 0, err
+        }
+
+        reviews, err := a.requeueStale(ctx, models.JobKindInputReview, `
+                SELECT DISTINCT ir.project_uuid
+                FROM input_reviews ir
+                JOIN projects p ON p.uuid = ir.project_uuid
+                WHERE ir.status IN ('pending', 'processing') AND p.status <> 'cancelled'`)
+        if err != nil {
+                return analyses, err
+        }
+
+        tag, err := a.db.Exec(ctx, `
+                INSERT INTO jobs (kind, project_uuid, file_id, max_attempts)
+                SELECT $1, f.project_uuid, f.id, $2
+                FROM project_files f
+                JOIN projects p ON p.uuid = f.project_uuid
+                WHERE f.analysis_status IN ('queued', 'analyzing') AND p.status = 'collecting'
+                  AND NOT EXISTS (
+                      SELECT 1 FROM jobs j
+                      WHERE j.kind = $1 AND j.file_id = f.id AND j.status IN ('queued', 'running'))
+                ON CONFLICT (kind, project_uuid, COALESCE(file_id, 0)) WHERE status = 'queued' DO NOTHING`,
+                models.JobKindFileAnalysis, defaultJobMaxAttempts)
+        if err != nil {
+                return analyses + reviews, fmt.Errorf("failed to recover %s jobs: %w", models.JobKindFileAnalysis, err)
+        }
+        files := int(tag.RowsAffected())
+
+        if analyses+reviews+files > 0 {
+                log.Printf("Recovered %d final analyses, %d input reviews and %d file analyses", analyses, reviews, files)
+                a.jobs.notify()
+        }
+        return analyses + reviews + files, nil
+}
+
+// requeueStale enqueues a job of the kind for every project the candidates query returns
+// that has no queued or running job of that kind
+func (a *Analyzer) requeueStale(ctx context.Context, kind, candidates string) (int, error) {
+        tag, err := a.db.Exec(ctx, `
+                INSERT INTO jobs (kind, project_uuid, max_attempts)
+                SELECT $1, c.uuid, $2
+                FROM (`+candidates+`) AS c(uuid)
+                WHERE NOT EXISTS (
+                    SELECT 1 FROM jobs j
+                    WHERE j.kind = $1 AND j.project_uuid = c.uuid AND j.status IN ('queued', 'running'))
+                ON CONFLICT (kind, project_uuid, COALESCE(file_id, 0)) WHERE status = 'queued' DO NOTHING`,
+                kind, defaultJobMaxAttempts)
+        if err != nil {
+                return 0, fmt.Errorf("failed to recover %s jobs: %w", kind, err)
+        }
+        return int(tag.RowsAffected()), nil
+}
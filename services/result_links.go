@@ -0,0 +1,64 @@
+package services
+
+import (
+        "fmt"
+        "log"
+        "strings"
+
+        "github.com/performance-analyzer/models"
+)
+
+// aiResultLink is a link between a result anomaly and a file issue as returned by the model
+type aiResultLink struct {
+        Metric        string      `json:"metric"`
+        Endpoint      string      `json:"endpoint"`
+        ObservedValue interface{} `json:"observed_value"`
+        FileIssueID   int         `json:"file_issue_id"`
+        Explanation   string      `json:"explanation"`
+}
+
+// buildResultLinks keeps the links that reference a known file issue of the project
+// and fills in the issue location so the UI does not have to look it up
+func buildResultLinks(links []aiResultLink, issues []models.FileIssue) []models.ResultLink {
+        byID := make(map[int]models.FileIssue, len(issues))
+        for _, issue := range issues {
+                byID[issue.ID] = issue
+        }
+
+        result := []models.ResultLink{}
+        for _, link := range links {
+                issue, ok := byID[link.FileIssueID]
+                if !ok {
+                        log.Printf("Dropping result link to unknown file issue %d", link.FileIssueID)
+                        continue
+                }
+                if strings.TrimSpace(link.Metric) == "" {
+                        continue
+                }
+
+                result = append(result, models.ResultLink{
+                        Metric:        link.Metric,
+                        Endpoint:      link.Endpoint,
+                        ObservedValue: formatObservedValue(link.ObservedValue),
+                        FileIssueID:   issue.ID,
+                        IssueName:     issue.Name,
+                        Filename:      issue.Filename,
+                        LineStart:     issue.LineStart,
+                        Explanation:   link.Explanation,
+                })
+        }
+
+        return result
+}
+
+// formatObservedValue accepts both "4s" and 4000 from the model
+func formatObservedValue(value interface{}) string {
+        switch v := value.(type) {
+        case nil:
+                return ""
+        case string:
+                return v
+        default:
+                return fmt.Sprintf("%v", v)
+        }
+}
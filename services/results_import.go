@@ -0,0 +1,260 @@
+package services
+
+import (
+        "encoding/json"
+        "io"
+        "sort"
+        "strings"
+        "time"
+
+        "github.com/performance-analyzer/models"
+)
+
+// ResultsParser converts a testing tool's native report into the results model
+type ResultsParser interface {
+        Parse(r io.Reader, project *models.Project) (*models.SendResultsRequest, error)
+}
+
+// ResultsParserFunc adapts a function to ResultsParser
+type ResultsParserFunc func(r io.Reader, project *models.Project) (*models.SendResultsRequest, error)
+
+func (f ResultsParserFunc) Parse(r io.Reader, project *models.Project) (*models.SendResultsRequest, error) {
+        return f(r, project)
+}
+
+// resultsParsers holds the importers keyed by testing_tool; importers register themselves in init
+var resultsParsers = make(map[string]ResultsParser)
+
+// RegisterResultsParser makes an importer available for a testing tool
+func RegisterResultsParser(tool string, parser ResultsParser) {
+        resultsParsers[strings.ToLower(tool)] = parser
+}
+
+// LookupResultsParser finds the importer for a format or testing_tool value.
+// Tool names like "Apache JMeter" or "Grafana k6" match the registered short name.
+func LookupResultsParser(tool string) (ResultsParser, bool) {
+        tool = strings.ToLower(strings.TrimSpace(tool))
+        if parser, ok := resultsParsers[tool]; ok {
+                return parser, true
+        }
+        for _, word := range strings.FieldsFunc(tool, func(r rune) bool { return r == ' ' || r == '-' || r == '_' || r == '/' || r == '.' }) {
+                if parser, ok := resultsParsers[word]; ok {
+                        return parser, true
+                }
+        }
+        return nil, false
+}
+
+// ResultsFormats lists the registered importers
+func ResultsFormats() []string {
+        formats := make([]string, 0, len(resultsParsers))
+        for tool := range resultsParsers {
+                formats = append(formats, tool)
+        }
+        sort.Strings(formats)
+        return formats
+}
+
+// endpointSamples is the running aggregate of one request label
+type endpointSamples struct {
+        endpoint models.EndpointMetrics
+        latency  *hdrHistogram
+}
+
+// intervalSamples is the running aggregate of one time bucket across all labels
+type intervalSamples struct {
+        latency  *hdrHistogram
+        requests int
+        errors   int
+        vus      *int
+}
+
+// sampleAggregator turns individual request samples from a tool's raw log into
+// per-endpoint metrics, run-wide totals and a time series of sampleIntervalSeconds buckets
+type sampleAggregator struct {
+        endpoints  map[string]*endpointSamples
+        intervals  map[int64]*intervalSamples
+        start, end time.Time
+        successful int
+        failed     int
+}
+
+func newSampleAggregator() *sampleAggregator {
+        return &sampleAggregator{
+                endpoints: make(map[string]*endpointSamples),
+                intervals: make(map[int64]*intervalSamples),
+        }
+}
+
+// interval returns the time bucket a moment falls into
+func (s *sampleAggregator) interval(at time.Time) *intervalSamples {
+        key := at.Unix() - at.Unix()%sampleIntervalSeconds
+        bucket, exists := s.intervals[key]
+        if !exists {
+                bucket = &intervalSamples{latency: newHDRHistogram()}
+                s.intervals[key] = bucket
+        }
+        return bucket
+}
+
+// ObserveVUs records the number of active virtual users the tool reported at a moment;
+// a bucket keeps the highest value seen
+func (s *sampleAggregator) ObserveVUs(at time.Time, vus int) {
+        if at.IsZero() || vus < 0 {
+                return
+        }
+        bucket := s.interval(at)
+        if bucket.vus == nil || vus > *bucket.vus {
+                bucket.vus = &vus
+        }
+}
+
+// Add records one sample. Labels like "GET /items" are split into method and name;
+// errorCode is counted only for failed samples.
+func (s *sampleAggregator) Add(label string, start time.Time, elapsed time.Duration, ok bool, errorCode string) {
+        method, name := splitEndpointKey(label)
+        if name == "" {
+                name = "unnamed"
+        }
+        key := EndpointLabel(models.EndpointMetrics{Method: method, Name: name})
+
+        samples, exists := s.endpoints[key]
+        if !exists {
+                samples = &endpointSamples{
+                        endpoint: models.EndpointMetrics{Name: name, Method: method},
+                        latency:  newHDRHistogram(),
+                }
+                s.endpoints[key] = samples
+        }
+
+        samples.endpoint.Requests++
+        samples.latency.RecordDuration(elapsed)
+        if ok {
+                s.successful++
+        } else {
+                s.failed++
+                samples.endpoint.Errors++
+                if errorCode == "" {
+                        errorCode = "error"
+                }
+                if samples.endpoint.ErrorCounts == nil {
+                        samples.endpoint.ErrorCounts = make(map[string]int)
+                }
+                samples.endpoint.ErrorCounts[errorCode]++
+        }
+
+        if start.IsZero() {
+                return
+        }
+        bucket := s.interval(start)
+        bucket.requests++
+        bucket.latency.RecordDuration(elapsed)
+        if !ok {
+                bucket.errors++
+        }
+
+        if s.start.IsZero() || start.Before(s.start) {
+                s.start = start
+        }
+        if end := start.Add(elapsed); end.After(s.end) {
+                s.end = end
+        }
+}
+
+// Result builds the results request; throughput is measured over the span of all samples
+func (s *sampleAggregator) Result() *models.SendResultsRequest {
+        req := &models.SendResultsRequest{
+                SuccessfulCalls: s.successful,
+                FailedCalls:     s.failed,
+        }
+
+        var seconds float64
+        if !s.start.IsZero() && s.end.After(s.start) {
+                seconds = s.end.Sub(s.start).Seconds()
+                req.TestDuration, _ = json.Marshal(seconds)
+                rps := float64(s.successful+s.failed) / seconds
+                req.AchievedRPS = &rps
+        }
+
+        for _, samples := range s.endpoints {
+                endpoint := samples.endpoint
+                samples.latency.Fill(&endpoint)
+                if seconds > 0 {
+                        rps := float64(endpoint.Requests) / seconds
+                        endpoint.RPS = &rps
+                }
+                req.Endpoints = append(req.Endpoints, endpoint)
+        }
+        sort.Slice(req.Endpoints, func(i, j int) bool {
+                return EndpointLabel(req.Endpoints[i]) < EndpointLabel(req.Endpoints[j])
+        })
+        req.Intervals = s.timeSeries()
+
+        return req
+}
+
+// timeSeries converts the time buckets into intervals. The first and last buckets are
+// clipped to the run, so a partial bucket does not understate throughput.
+func (s *sampleAggregator) timeSeries() []models.MetricInterval {
+        keys := make([]int64, 0, len(s.intervals))
+        for key, bucket := range s.intervals {
+                if bucket.requests > 0 {
+                        keys = append(keys, key)
+                }
+        }
+        sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+        intervals := make([]models.MetricInterval, 0, len(keys))
+        for _, key := range keys {
+                bucket := s.intervals[key]
+                from := time.Unix(key, 0)
+                to := from.Add(sampleIntervalSeconds * time.Second)
+                if from.Before(s.start) {
+                        from = s.start
+                }
+                if to.After(s.end) {
+                        to = s.end
+                }
+                seconds := to.Sub(from).Seconds()
+                if seconds <= 0 {
+                        seconds = sampleIntervalSeconds
+                }
+
+                ms := func(p float64) *float64 {
+                        value := float64(bucket.latency.ValueAtPercentile(p)) / 1000
+                        return &value
+                }
+                rps := float64(bucket.requests) / seconds
+                intervals = append(intervals, models.MetricInterval{
+                        Start:           from.UTC(),
+                        DurationSeconds: seconds,
+                        RPS:             &rps,
+                        ActiveVUs:       bucket.vus,
+                        P50:             ms(50),
+                        P90:             ms(90),
+                        P95:             ms(95),
+                        P99:             ms(99),
+                        Requests:        bucket.requests,
+                        Errors:          bucket.errors,
+                })
+        }
+        return intervals
+}
+
+// evaluateImportedNFRs checks the project's nonfunctional requirements against imported
+// results, so tool reports carry assertion outcomes even when none were coded into the script
+func evaluateImportedNFRs(project *models.Project, req *models.SendResultsRequest) []models.NFRResult {
+        if project == nil {
+                return nil
+        }
+        rules, unparsed := ParseNFRRules(parseProjectInfo(project.ProjectInfo).NonfunctionalRequirements)
+        if len(rules) == 0 && len(unparsed) == 0 {
+                return nil
+        }
+
+        totals := resultTotals{successful: req.SuccessfulCalls, failed: req.FailedCalls}
+        if req.AchievedRPS != nil {
+                totals.rps = *req.AchievedRPS
+        }
+        return evaluateNFRs(rules, unparsed, req.Endpoints, totals)
+}
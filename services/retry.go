@@ -0,0 +1,177 @@
+package services
+
+import (
+        "context"
+        "errors"
+        "fmt"
+        "io"
+        "log"
+        "math/rand"
+        "net"
+        "strings"
+        "time"
+
+        "github.com/google/uuid"
+        "github.com/jackc/pgx/v5"
+        "github.com/jackc/pgx/v5/pgconn"
+        "github.com/performance-analyzer/models"
+)
+
+const (
+        // stageMaxAttempts is how many times a stage is run within one job before the job fails
+        stageMaxAttempts    = 3
+        stageRetryBaseDelay = 2 * time.Second
+        stageRetryMaxDelay  = 30 * time.Second
+        // A job that failed with a transient error is queued again after a longer pause, so an
+        // outage of the AI model or the database has time to end
+        jobRetryBaseDelay = time.Minute
+        jobRetryMaxDelay  = 30 * time.Minute
+)
+
+// transientError marks a failure that may succeed when retried
+type transientError struct {
+        err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+// transient marks err as worth retrying
+func transient(err error) error {
+        return &transientError{err: err}
+}
+
+// StageError is the error of an analysis stage that ran out of attempts or failed permanently
+type StageError struct {
+        Stage     string
+        Attempts  int
+        Transient bool
+        Err       error
+}
+
+func (e *StageError) Error() string {
+        return fmt.Sprintf("%s stage failed after %d attempt(s): %v", e.Stage, e.Attempts, e.Err)
+}
+
+func (e *StageError) Unwrap() error { return e.Err }
+
+// isTransient tells whether an error may go away on its own: timeouts, lost connections and
+// overloaded services are transient; missing data, invalid input and unknown errors are not
+func isTransient(err error) bool {
+        if err == nil {
+                return false
+        }
+
+        var stageErr *StageError
+        if errors.As(err, &stageErr) {
+                return stageErr.Transient
+        }
+        var marked *transientError
+        if errors.As(err, &marked) {
+                return true
+        }
+        if errors.Is(err, pgx.ErrNoRows) {
+                return false
+        }
+        if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+                return true
+        }
+
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) {
+                // Connection exceptions, serialization failures and deadlocks, insufficient
+                // resources and operator intervention such as a server restart
+                for _, class := range []string{"08", "40", "53", "57"} {
+                        if strings.HasPrefix(pgErr.Code, class) {
+                                return true
+                        }
+                }
+                return false
+        }
+
+        var connectErr *pgconn.ConnectError
+        if errors.As(err, &connectErr) || pgconn.Timeout(err) || pgconn.SafeToRetry(err) {
+                return true
+        }
+        var netErr net.Error
+        return errors.As(err, &netErr)
+}
+
+// backoffDelay is the pause before the given retry: exponential growth from base, capped at
+// max, with jitter so that jobs failed by the same outage do not retry in lockstep
+func backoffDelay(attempt int, base, max time.Duration) time.Duration {
+        delay := base
+        for i := 1; i < attempt && delay < max; i++ {
+                delay *= 2
+        }
+        if delay > max {
+                delay = max
+        }
+        return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// runStage runs one stage of the final analysis, retrying transient errors with backoff.
+// Every failed attempt is written to the attempts log of the project.
+func (a *Analyzer) runStage(ctx context.Context, projectUUID uuid.UUID, stage string, fn func() error) error {
+        for attempt := 1; ; attempt++ {
+                err := fn()
+                if err == nil {
+                        return nil
+                }
+
+                if ctx.Err() != nil {
+                        // Cancelled by shutdown; the job is queued again, so this is not a failed attempt
+                        return err
+                }
+
+                retryable := isTransient(err)
+                a.recordAttempt(ctx, projectUUID, stage, err, retryable)
+                if !retryable || attempt >= stageMaxAttempts {
+                        return &StageError{Stage: stage, Attempts: attempt, Transient: retryable, Err: err}
+                }
+
+                delay := backoffDelay(attempt, stageRetryBaseDelay, stageRetryMaxDelay)
+                log.Printf("Stage %s of analysis %s failed (attempt %d), retrying in %v: %v", stage, projectUUID, attempt, delay, err)
+                select {
+                case <-time.After(delay):
+                case <-ctx.Done():
+                        return ctx.Err()
+                }
+        }
+}
+
+// recordAttempt appends a failed stage attempt to the attempts log
+func (a *Analyzer) recordAttempt(ctx context.Context, projectUUID uuid.UUID, stage string, stageErr error, retryable bool) {
+        _, err := a.db.Exec(ctx,
+                `INSERT INTO analysis_attempts (project_uuid, stage, attempt, error_message, transient)
+                 SELECT $1, $2, COALESCE(MAX(attempt), 0) + 1, $3, $4
+                 FROM analysis_attempts WHERE project_uuid = $1 AND stage = $2`,
+                projectUUID, stage, stageErr.Error(), retryable)
+        if err != nil {
+                log.Printf("Failed to record %s attempt of analysis %s: %v", stage, projectUUID, err)
+        }
+}
+
+// GetAnalysisAttempts returns the failed attempts of the final analysis, oldest first
+func (a *Analyzer) GetAnalysisAttempts(ctx context.Context, projectUUID uuid.UUID) ([]models.AnalysisAttempt, error) {
+        rows, err := a.db.Query(ctx,
+                `SELECT id, project_uuid, stage, attempt, error_message, transient, created_at
+                 FROM analysis_attempts WHERE project_uuid = $1
+                 ORDER BY created_at, id`, projectUUID)
+        if err != nil {
+                return nil, err
+        }
+        defer rows.Close()
+
+        attempts := []models.AnalysisAttempt{}
+        for rows.Next() {
+                var attempt models.AnalysisAttempt
+                err := rows.Scan(&attempt.ID, &attempt.ProjectUUID, &attempt.Stage, &attempt.Attempt,
+                        &attempt.ErrorMessage, &attempt.Transient, &attempt.CreatedAt)
+                if err != nil {
+                        return nil, err
+                }
+                attempts = append(attempts, attempt)
+        }
+        return attempts, rows.Err()
+}
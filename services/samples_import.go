@@ -0,0 +1,246 @@
+package services
+
+import (
+        "bufio"
+        "bytes"
+        "encoding/csv"
+        "encoding/json"
+        "fmt"
+        "io"
+        "math"
+        "strconv"
+        "strings"
+        "time"
+
+        "github.com/performance-analyzer/models"
+)
+
+func init() {
+        RegisterResultsParser("samples", ResultsParserFunc(ParseLatencySamples))
+}
+
+// samplesDefaultColumns is the CSV column order when the file has no header
+var samplesDefaultColumns = []string{"timestamp", "endpoint", "latency_ms", "status", "error"}
+
+// latencySample is one NDJSON line of raw samples
+type latencySample struct {
+        Timestamp json.RawMessage `json:"timestamp"`
+        Endpoint  string          `json:"endpoint"`
+        LatencyMs *float64        `json:"latency_ms"`
+        Status    json.RawMessage `json:"status"`
+        Error     string          `json:"error"`
+}
+
+// ParseLatencySamples reads raw per-request samples (NDJSON, or CSV of timestamp, endpoint,
+// latency_ms, status and an optional error) and computes the percentiles of every endpoint
+// from HDR histograms instead of trusting percentiles precomputed by the tool
+func ParseLatencySamples(r io.Reader, project *models.Project) (*models.SendResultsRequest, error) {
+        reader := bufio.NewReaderSize(r, 64*1024)
+        head, _ := reader.Peek(512)
+
+        aggregator := newSampleAggregator()
+        var count int
+        var err error
+        input := "csv"
+        if trimmed := bytes.TrimSpace(head); len(trimmed) > 0 && trimmed[0] == '{' {
+                input = "ndjson"
+                count, err = readSamplesNDJSON(reader, aggregator)
+        } else {
+                count, err = readSamplesCSV(reader, aggregator)
+        }
+        if err != nil {
+                return nil, err
+        }
+        if count == 0 {
+                return nil, fmt.Errorf("no samples")
+        }
+
+        req := aggregator.Result()
+        raw := map[string]interface{}{
+                "source":     "samples",
+                "input":      input,
+                "samples":    count,
+                "assertions": evaluateImportedNFRs(project, req),
+        }
+        req.RawResults, _ = json.Marshal(raw)
+
+        return req, nil
+}
+
+func readSamplesNDJSON(r io.Reader, aggregator *sampleAggregator) (int, error) {
+        decoder := json.NewDecoder(r)
+        count := 0
+        for {
+                var sample latencySample
+                err := decoder.Decode(&sample)
+                if err == io.EOF {
+                        break
+                }
+                if err != nil {
+                        return count, fmt.Errorf("sample %d: %w", count+1, err)
+                }
+                if sample.LatencyMs == nil {
+                        return count, fmt.Errorf("sample %d: latency_ms is required", count+1)
+                }
+
+                var timestamp, status string
+                if json.Unmarshal(sample.Timestamp, &timestamp) != nil {
+                        timestamp = string(sample.Timestamp)
+                }
+                if json.Unmarshal(sample.Status, &status) != nil {
+                        status = string(sample.Status)
+                }
+
+                if err := addLatencySample(aggregator, timestamp, sample.Endpoint, *sample.LatencyMs, status, sample.Error); err != nil {
+                        return count, fmt.Errorf("sample %d: %w", count+1, err)
+                }
+                count++
+        }
+        return count, nil
+}
+
+func readSamplesCSV(r io.Reader, aggregator *sampleAggregator) (int, error) {
+        reader := csv.NewReader(r)
+        reader.FieldsPerRecord = -1
+        reader.ReuseRecord = true
+
+        first, err := reader.Read()
+        if err == io.EOF {
+                return 0, nil
+        }
+        if err != nil {
+                return 0, fmt.Errorf("invalid samples CSV: %w", err)
+        }
+
+        // A header is recognized by its latency column
+        columns := make(map[string]int)
+        headerless := true
+        for _, name := range first {
+                if name := strings.ToLower(strings.TrimSpace(name)); name == "latency_ms" || name == "latency" {
+                        headerless = false
+                }
+        }
+        names := samplesDefaultColumns
+        if !headerless {
+                names = first
+        }
+        for i, name := range names {
+                name = strings.ToLower(strings.TrimSpace(name))
+                if name == "latency" {
+                        name = "latency_ms"
+                }
+                columns[name] = i
+        }
+
+        field := func(record []string, name string) string {
+                if i, ok := columns[name]; ok && i < len(record) {
+                        return strings.TrimSpace(record[i])
+                }
+                return ""
+        }
+
+        count := 0
+        add := func(record []string) error {
+                latency, err := strconv.ParseFloat(field(record, "latency_ms"), 64)
+                if err != nil {
+                        return fmt.Errorf("sample %d: invalid latency_ms %q", count+1, field(record, "latency_ms"))
+                }
+                if err := addLatencySample(aggregator, field(record, "timestamp"), field(record, "endpoint"),
+                        latency, field(record, "status"), field(record, "error")); err != nil {
+                        return fmt.Errorf("sample %d: %w", count+1, err)
+                }
+                count++
+                return nil
+        }
+
+        if headerless {
+                if err := add(first); err != nil {
+                        return count, err
+                }
+        }
+        for {
+                record, err := reader.Read()
+                if err == io.EOF {
+                        break
+                }
+                if err != nil {
+                        return count, fmt.Errorf("invalid samples CSV: %w", err)
+                }
+                if err := add(record); err != nil {
+                        return count, err
+                }
+        }
+        return count, nil
+}
+
+// addLatencySample validates one sample and adds it to the aggregator
+func addLatencySample(aggregator *sampleAggregator, timestamp, endpoint string, latencyMs float64, status, errorText string) error {
+        if strings.TrimSpace(endpoint) == "" {
+                return fmt.Errorf("endpoint is required")
+        }
+        if latencyMs < 0 || math.IsNaN(latencyMs) || math.IsInf(latencyMs, 0) {
+                return fmt.Errorf("invalid latency_ms %g", latencyMs)
+        }
+
+        start, err := parseSampleTimestamp(timestamp)
+        if err != nil {
+                return err
+        }
+
+        ok, code := parseSampleStatus(status)
+        if errorText != "" {
+                ok = false
+                if code == "" || !isInteger(code) {
+                        code = truncateErrorCode(errorText)
+                }
+        }
+
+        aggregator.Add(endpoint, start, time.Duration(latencyMs*float64(time.Millisecond)), ok, code)
+        return nil
+}
+
+// parseSampleTimestamp reads RFC 3339 times or Unix epoch numbers; the epoch unit
+// (seconds, milliseconds, microseconds or nanoseconds) is inferred from the magnitude
+func parseSampleTimestamp(text string) (time.Time, error) {
+        text = strings.TrimSpace(text)
+        if text == "" || text == "null" {
+                return time.Time{}, fmt.Errorf("timestamp is required")
+        }
+
+        if value, err := strconv.ParseFloat(text, 64); err == nil {
+                switch {
+                case value >= 1e17:
+                        return time.Unix(0, int64(value)), nil
+                case value >= 1e14:
+                        return time.UnixMicro(int64(value)), nil
+                case value >= 1e11:
+                        return time.UnixMilli(int64(value)), nil
+                default:
+                        seconds, fraction := math.Modf(value)
+                        return time.Unix(int64(seconds), int64(fraction*1e9)), nil
+                }
+        }
+
+        t, err := time.Parse(time.RFC3339Nano, text)
+        if err != nil {
+                return time.Time{}, fmt.Errorf("invalid timestamp %q", text)
+        }
+        return t, nil
+}
+
+// parseSampleStatus accepts HTTP codes (1xx-3xx succeed) or words like "ok" and "error".
+// The returned code is used as the error_counts key for failed samples.
+func parseSampleStatus(status string) (bool, string) {
+        status = strings.TrimSpace(status)
+        if status == "" || status == "null" {
+                return true, ""
+        }
+        if code, err := strconv.Atoi(status); err == nil {
+                return code > 0 && code < 400, status
+        }
+        switch strings.ToLower(status) {
+        case "ok", "success", "true", "pass", "passed":
+                return true, ""
+        }
+        return false, truncateErrorCode(status)
+}
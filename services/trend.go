@@ -0,0 +1,228 @@
+package services
+
+import (
+        "context"
+        "encoding/json"
+        "fmt"
+        "sort"
+        "strings"
+        "time"
+
+        "github.com/performance-analyzer/models"
+)
+
+// trendScoreStep is the overall_score change that counts as a move rather than model noise
+const trendScoreStep = 1.0
+
+// ParseTrendRange reads the from/to filters as RFC 3339 times or dates. A date in "to"
+// includes the whole day.
+func ParseTrendRange(fromText, toText string) (*time.Time, *time.Time, error) {
+        from, err := parseTrendTime(fromText, false)
+        if err != nil {
+                return nil, nil, fmt.Errorf("invalid from: %w", err)
+        }
+        to, err := parseTrendTime(toText, true)
+        if err != nil {
+                return nil, nil, fmt.Errorf("invalid to: %w", err)
+        }
+        if from != nil && to != nil && !from.Before(*to) {
+                return nil, nil, fmt.Errorf("from must be before to")
+        }
+        return from, to, nil
+}
+
+func parseTrendTime(text string, endOfDay bool) (*time.Time, error) {
+        text = strings.TrimSpace(text)
+        if text == "" {
+                return nil, nil
+        }
+        if t, err := time.Parse(time.RFC3339, text); err == nil {
+                return &t, nil
+        }
+        t, err := time.Parse("2006-01-02", text)
+        if err != nil {
+                return nil, fmt.Errorf("expected RFC 3339 time or YYYY-MM-DD date, got %q", text)
+        }
+        if endOfDay {
+                t = t.AddDate(0, 0, 1)
+        }
+        return &t, nil
+}
+
+// GetRepoTrend returns every run of a tenant/repo created within [from, to) with its overall
+// score, error rate, per-endpoint tail latency and issue counts, and how each of them moved
+func (a *Analyzer) GetRepoTrend(ctx context.Context, tenant, repo string, from, to *time.Time) (*models.RepoTrend, error) {
+        query := `
+                SELECT p.uuid, p.status, p.created_at,
+                       tr.id, tr.successful_calls, tr.failed_calls, tr.achieved_rps,
+                       ar.final_analysis -> 'ai_analysis' -> 'overall_score',
+                       (SELECT COUNT(*) FROM file_issues fi WHERE fi.project_uuid = p.uuid),
+                       (SELECT COUNT(*) FROM file_issues fi WHERE fi.project_uuid = p.uuid AND fi.state = 'confirmed')
+                FROM projects p
+                LEFT JOIN LATERAL (
+                    SELECT id, successful_calls, failed_calls, achieved_rps FROM test_results
+                    WHERE project_uuid = p.uuid ORDER BY created_at DESC LIMIT 1
+                ) tr ON true
+                LEFT JOIN LATERAL (
+                    SELECT final_analysis FROM analysis_results
+                    WHERE project_uuid = p.uuid AND status = 'completed' ORDER BY created_at DESC LIMIT 1
+                ) ar ON true
+                WHERE p.tenant = $1 AND p.repo = $2
+                  AND ($3::timestamp IS NULL OR p.created_at >= $3)
+                  AND ($4::timestamp IS NULL OR p.created_at < $4)
+                ORDER BY p.created_at`
+
+        rows, err := a.db.Query(ctx, query, tenant, repo, from, to)
+        if err != nil {
+                return nil, err
+        }
+        defer rows.Close()
+
+        trend := &models.RepoTrend{Tenant: tenant, Repo: repo, From: from, To: to, Points: []models.TrendPoint{}}
+        pointByResult := make(map[int]int)
+        var resultIDs []int
+        for rows.Next() {
+                var point models.TrendPoint
+                var testResultID, successful, failed *int
+                var score json.RawMessage
+                err := rows.Scan(&point.ProjectUUID, &point.Status, &point.CreatedAt,
+                        &testResultID, &successful, &failed, &point.AchievedRPS,
+                        &score, &point.OpenIssues, &point.ConfirmedIssues)
+                if err != nil {
+                        return nil, err
+                }
+
+                var scoreValue interface{}
+                if json.Unmarshal(score, &scoreValue) == nil {
+                        point.OverallScore = parseScore(scoreValue)
+                }
+                if successful != nil && failed != nil && *successful+*failed > 0 {
+                        rate := float64(*failed) / float64(*successful+*failed) * 100
+                        point.ErrorRatePercent = &rate
+                }
+                point.Endpoints = []models.TrendEndpoint{}
+                if testResultID != nil {
+                        pointByResult[*testResultID] = len(trend.Points)
+                        resultIDs = append(resultIDs, *testResultID)
+                }
+                trend.Points = append(trend.Points, point)
+        }
+        if err := rows.Err(); err != nil {
+                return nil, err
+        }
+
+        if len(resultIDs) > 0 {
+                endpointRows, err := a.db.Query(ctx, `
+                        SELECT test_result_id, name, method, p95, p99
+                        FROM endpoint_metrics
+                        WHERE test_result_id = ANY($1)
+                        ORDER BY method, name`, resultIDs)
+                if err != nil {
+                        return nil, err
+                }
+                defer endpointRows.Close()
+
+                for endpointRows.Next() {
+                        var testResultID int
+                        var endpoint models.EndpointMetrics
+                        if err := endpointRows.Scan(&testResultID, &endpoint.Name, &endpoint.Method, &endpoint.P95, &endpoint.P99); err != nil {
+                                return nil, err
+                        }
+                        point := &trend.Points[pointByResult[testResultID]]
+                        point.Endpoints = append(point.Endpoints, models.TrendEndpoint{
+                                Endpoint: EndpointLabel(endpoint),
+                                P95:      endpoint.P95,
+                                P99:      endpoint.P99,
+                        })
+                }
+                if err := endpointRows.Err(); err != nil {
+                        return nil, err
+                }
+        }
+
+        trend.Changes = summarizeTrend(trend.Points)
+        return trend, nil
+}
+
+// summarizeTrend tells for every series whether it improved or degraded from its first run
+// to its last, using the default regression tolerances
+func summarizeTrend(points []models.TrendPoint) []models.TrendChange {
+        changes := []models.TrendChange{}
+        add := func(metric, endpoint string, value func(models.TrendPoint) *float64, direction func(first, last float64) string) {
+                change := models.TrendChange{Metric: metric, Endpoint: endpoint}
+                for _, point := range points {
+                        if v := value(point); v != nil {
+                                if change.First == nil {
+                                        change.First = v
+                                }
+                                change.Last = v
+                                change.Runs++
+                        }
+                }
+                if change.Runs < 2 {
+                        return
+                }
+                change.Direction = direction(*change.First, *change.Last)
+                changes = append(changes, change)
+        }
+
+        add("overall_score", "", func(p models.TrendPoint) *float64 { return p.OverallScore }, func(first, last float64) string {
+                return trendDirection(last-first, trendScoreStep, true)
+        })
+        add("error_rate", "", func(p models.TrendPoint) *float64 { return p.ErrorRatePercent }, func(first, last float64) string {
+                return trendDirection(last-first, DefaultRegressionTolerances.ErrorRatePoints, false)
+        })
+
+        var endpoints []string
+        seen := make(map[string]bool)
+        for _, point := range points {
+                for _, endpoint := range point.Endpoints {
+                        if !seen[endpoint.Endpoint] {
+                                seen[endpoint.Endpoint] = true
+                                endpoints = append(endpoints, endpoint.Endpoint)
+                        }
+                }
+        }
+        sort.Strings(endpoints)
+
+        latency := func(first, last float64) string {
+                if first <= 0 {
+                        return trendDirection(last, 0, false)
+                }
+                return trendDirection((last-first)/first*100, DefaultRegressionTolerances.LatencyPercent, false)
+        }
+        for _, label := range endpoints {
+                for _, metric := range []string{"p95", "p99"} {
+                        add(metric, label, func(p models.TrendPoint) *float64 {
+                                for _, endpoint := range p.Endpoints {
+                                        if endpoint.Endpoint == label {
+                                                if metric == "p95" {
+                                                        return endpoint.P95
+                                                }
+                                                return endpoint.P99
+                                        }
+                                }
+                                return nil
+                        }, latency)
+                }
+        }
+
+        return changes
+}
+
+// trendDirection classifies a change; higherIsBetter tells which way is an improvement
+func trendDirection(change, tolerance float64, higherIsBetter bool) string {
+        switch {
+        case change > tolerance:
+                if higherIsBetter {
+                        return models.TrendImproving
+                }
+                return models.TrendDegrading
+        case change < -tolerance:
+                if higherIsBetter {
+                        return models.TrendDegrading
+                }
+                return models.TrendImproving
+        }
+        return models.TrendStable
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+        "encoding/json"
+        "fmt"
+        "time"
+
+        "github.com/performance-analyzer/models"
+)
+
+const (
+        // loadTolerance is the share of the planned load or duration a run must reach to count
+        loadTolerance = 0.9
+        // defaultMaxErrorRatePercent invalidates a run when project_info sets no error budget
+        defaultMaxErrorRatePercent = 5.0
+)
+
+// actualLoad is what the test really achieved, as far as the results tell
+type actualLoad struct {
+        totalCalls int
+        errorRate  float64
+        duration   time.Duration
+        rps        float64
+        stages     []models.StageResult
+}
+
+// EvaluateTestValidity decides deterministically whether the load test was conducted
+// correctly by comparing the planned profile from project_info with the actual results
+func EvaluateTestValidity(info models.ProjectInfo, results *models.TestResults) models.TestValidity {
+        actual := readActualLoad(results)
+
+        checks := []models.ValidityCheck{
+                checkCallsMade(actual),
+                checkAchievedLoad(info, actual),
+                checkDuration(info, actual),
+                checkStages(info, actual),
+                checkErrorRate(info, actual),
+        }
+
+        validity := models.TestValidity{Valid: true, Reasons: []string{}, Checks: checks}
+        evaluated := 0
+        loadEvaluated := false
+        for _, check := range checks {
+                if check.Status == models.CheckSkipped {
+                        continue
+                }
+                evaluated++
+                if check.Name == "achieved_load" {
+                        loadEvaluated = true
+                }
+                if check.Status == models.CheckFailed {
+                        validity.Valid = false
+                        validity.Reasons = append(validity.Reasons, check.Detail)
+                }
+        }
+
+        switch {
+        case evaluated >= 4 && loadEvaluated:
+                validity.Confidence = models.ConfidenceHigh
+        case evaluated >= 2:
+                validity.Confidence = models.ConfidenceMedium
+        default:
+                validity.Confidence = models.ConfidenceLow
+        }
+
+        if validity.Valid {
+                validity.Reasons = append(validity.Reasons, "All evaluated checks passed")
+        }
+
+        return validity
+}
+
+func readActualLoad(results *models.TestResults) actualLoad {
+        actual := actualLoad{totalCalls: results.SuccessfulCalls + results.FailedCalls}
+        if actual.totalCalls > 0 {
+                actual.errorRate = float64(results.FailedCalls) / float64(actual.totalCalls) * 100
+        }
+
+        // Older clients only put the actual load into raw_results
+        var legacy struct {
+                RawResults struct {
+                        TestDuration      json.RawMessage `json:"test_duration"`
+                        RequestsPerSecond float64         `json:"requests_per_second"`
+                } `json:"raw_results"`
+        }
+        if len(results.RawResults) > 0 {
+                json.Unmarshal(results.RawResults, &legacy)
+        }
+
+        if results.TestDurationSeconds != nil {
+                actual.duration = time.Duration(*results.TestDurationSeconds * float64(time.Second))
+        } else if d, err := ParseDurationValue(legacy.RawResults.TestDuration); err == nil {
+                actual.duration = d
+        }
+
+        switch {
+        case results.AchievedRPS != nil:
+                actual.rps = *results.AchievedRPS
+        case legacy.RawResults.RequestsPerSecond > 0:
+                actual.rps = legacy.RawResults.RequestsPerSecond
+        case actual.duration > 0:
+                actual.rps = float64(actual.totalCalls) / actual.duration.Seconds()
+        }
+
+        if len(results.Stages) > 0 {
+                json.Unmarshal(results.Stages, &actual.stages)
+        }
+
+        return actual
+}
+
+func checkCallsMade(actual actualLoad) models.ValidityCheck {
+        check := models.ValidityCheck{
+                Name:     "calls_made",
+                Expected: "> 0",
+                Actual:   fmt.Sprintf("%d", actual.totalCalls),
+                Status:   models.CheckPassed,
+                Detail:   "The test produced requests",
+        }
+        if actual.totalCalls == 0 {
+                check.Status = models.CheckFailed
+                check.Detail = "The test did not produce any requests"
+        }
+        return check
+}
+
+func checkAchievedLoad(info models.ProjectInfo, actual actualLoad) models.ValidityCheck {
+        check := models.ValidityCheck{Name: "achieved_load"}
+
+        planned := plannedRPS(info)
+        if planned <= 0 {
+                check.Status = models.CheckSkipped
+                check.Detail = "Expected load is not specified in project_info"
+                return check
+        }
+        check.Expected = fmt.Sprintf(">= %.1f RPS (%.0f%% of %.1f)", planned*loadTolerance, loadTolerance*100, planned)
+
+        if actual.rps <= 0 {
+                check.Status = models.CheckSkipped
+                check.Detail = "Achieved throughput is not reported"
+                return check
+        }
+        check.Actual = fmt.Sprintf("%.1f RPS", actual.rps)
+
+        if actual.rps < planned*loadTolerance {
+                check.Status = models.CheckFailed
+                check.Detail = fmt.Sprintf("Achieved load %.1f RPS is %.0f%% of the expected %.1f RPS",
+                        actual.rps, actual.rps/planned*100, planned)
+                return check
+        }
+
+        check.Status = models.CheckPassed
+        check.Detail = "Achieved load matches the expected load"
+        return check
+}
+
+func checkDuration(info models.ProjectInfo, actual actualLoad) models.ValidityCheck {
+        check := models.ValidityCheck{Name: "duration"}
+
+        planned := plannedDuration(info)
+        if planned <= 0 {
+                check.Status = models.CheckSkipped
+                check.Detail = "Test duration is not specified in project_info"
+                return check
+        }
+        check.Expected = fmt.Sprintf(">= %s", time.Duration(float64(planned)*loadTolerance).Round(time.Second))
+
+        if actual.duration <= 0 {
+                check.Status = models.CheckSkipped
+                check.Detail = "Actual test duration is not reported"
+                return check
+        }
+        check.Actual = actual.duration.Round(time.Second).String()
+
+        if float64(actual.duration) < float64(planned)*loadTolerance {
+                check.Status = models.CheckFailed
+                check.Detail = fmt.Sprintf("The test ran for %s instead of the planned %s",
+                        actual.duration.Round(time.Second), planned.Round(time.Second))
+                return check
+        }
+
+        check.Status = models.CheckPassed
+        check.Detail = "The test ran for the planned duration"
+        return check
+}
+
+func checkStages(info models.ProjectInfo, actual actualLoad) models.ValidityCheck {
+        check := models.ValidityCheck{Name: "stages"}
+
+        if len(info.Stages) == 0 {
+                check.Status = models.CheckSkipped
+                check.Detail = "No ramp stages are declared in project_info"
+                return check
+        }
+        check.Expected = fmt.Sprintf("%d stages completed", len(info.Stages))
+
+        if len(actual.stages) == 0 {
+                // Without per-stage results a run that stopped early cannot have covered all stages
+                planned := plannedDuration(info)
+                if planned > 0 && actual.duration > 0 && float64(actual.duration) < float64(planned)*loadTolerance {
+                        check.Status = models.CheckFailed
+                        check.Actual = actual.duration.Round(time.Second).String()
+                        check.Detail = "The test stopped before all ramp stages could run"
+                        return check
+                }
+                check.Status = models.CheckSkipped
+                check.Detail = "Per-stage results are not reported"
+                return check
+        }
+
+        byName := make(map[string]models.StageResult)
+        for _, stage := range actual.stages {
+                if stage.Name != "" {
+                        byName[stage.Name] = stage
+                }
+        }
+
+        completed := 0
+        var problems []string
+        for i, planned := range info.Stages {
+                stage, ok := byName[planned.Name]
+                if !ok && i < len(actual.stages) && (planned.Name == "" || actual.stages[i].Name == "") {
+                        stage, ok = actual.stages[i], true
+                }
+
+                label := planned.Name
+                if label == "" {
+                        label = fmt.Sprintf("#%d", i+1)
+                }
+
+                switch {
+                case !ok:
+                        problems = append(problems, fmt.Sprintf("stage %s did not run", label))
+                case !stage.Completed:
+                        problems = append(problems, fmt.Sprintf("stage %s did not complete", label))
+                case planned.TargetRPS > 0 && stage.AchievedRPS < planned.TargetRPS*loadTolerance:
+                        problems = append(problems, fmt.Sprintf("stage %s reached %.1f of %.1f RPS",
+                                label, stage.AchievedRPS, planned.TargetRPS))
+                default:
+                        completed++
+                }
+        }
+        check.Actual = fmt.Sprintf("%d stages completed", completed)
+
+        if len(problems) > 0 {
+                check.Status = models.CheckFailed
+                check.Detail = fmt.Sprintf("Ramp stages did not run as planned: %v", problems)
+                return check
+        }
+
+        check.Status = models.CheckPassed
+        check.Detail = "All ramp stages ran as planned"
+        return check
+}
+
+func checkErrorRate(info models.ProjectInfo, actual actualLoad) models.ValidityCheck {
+        check := models.ValidityCheck{Name: "error_rate"}
+
+        if actual.totalCalls == 0 {
+                check.Status = models.CheckSkipped
+                check.Detail = "No requests to compute the error rate from"
+                return check
+        }
+
+        limit := defaultMaxErrorRatePercent
+        if info.MaxErrorRatePercent != nil {
+                limit = *info.MaxErrorRatePercent
+        }
+        check.Expected = fmt.Sprintf("<= %.2f%%", limit)
+        check.Actual = fmt.Sprintf("%.2f%%", actual.errorRate)
+
+        if actual.errorRate > limit {
+                check.Status = models.CheckFailed
+                check.Detail = fmt.Sprintf("Error rate %.2f%% exceeds %.2f%%, the run measured failures rather than performance",
+                        actual.errorRate, limit)
+                return check
+        }
+
+        check.Status = models.CheckPassed
+        check.Detail = "Error rate is within the limit"
+        return check
+}
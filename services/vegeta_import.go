@@ -0,0 +1,214 @@
+package services
+
+import (
+        "bufio"
+        "bytes"
+        "encoding/gob"
+        "encoding/json"
+        "fmt"
+        "io"
+        "math"
+        "net/http"
+        "net/url"
+        "strconv"
+        "time"
+
+        "github.com/performance-analyzer/models"
+)
+
+func init() {
+        RegisterResultsParser("vegeta", ResultsParserFunc(ParseVegetaResults))
+}
+
+// vegetaResult mirrors vegeta.Result; gob and JSON match fields by name,
+// so results can be decoded without importing vegeta
+type vegetaResult struct {
+        Attack    string        `json:"attack"`
+        Seq       uint64        `json:"seq"`
+        Code      uint16        `json:"code"`
+        Timestamp time.Time     `json:"timestamp"`
+        Latency   time.Duration `json:"latency"`
+        BytesOut  uint64        `json:"bytes_out"`
+        BytesIn   uint64        `json:"bytes_in"`
+        Error     string        `json:"error"`
+        Body      []byte        `json:"body"`
+        Method    string        `json:"method"`
+        URL       string        `json:"url"`
+        Headers   http.Header   `json:"headers"`
+}
+
+// vegetaReport is the output of `vegeta report -type=json`; durations are in nanoseconds
+type vegetaReport struct {
+        Latencies struct {
+                P50 float64 `json:"50th"`
+                P90 float64 `json:"90th"`
+                P95 float64 `json:"95th"`
+                P99 float64 `json:"99th"`
+                Max float64 `json:"max"`
+        } `json:"latencies"`
+        Duration    float64        `json:"duration"`
+        Wait        float64        `json:"wait"`
+        Requests    int            `json:"requests"`
+        Rate        float64        `json:"rate"`
+        Success     float64        `json:"success"`
+        StatusCodes map[string]int `json:"status_codes"`
+        Errors      []string       `json:"errors"`
+}
+
+// ParseVegetaResults reads a JSON report (`vegeta report -type=json`), JSON-encoded
+// results (`vegeta encode --to json`) or the binary results file written by `vegeta attack`
+func ParseVegetaResults(r io.Reader, project *models.Project) (*models.SendResultsRequest, error) {
+        reader := bufio.NewReaderSize(r, 64*1024)
+        head, _ := reader.Peek(512)
+
+        var req *models.SendResultsRequest
+        var err error
+        input := "binary"
+        if trimmed := bytes.TrimSpace(head); len(trimmed) > 0 && trimmed[0] == '{' {
+                input, req, err = readVegetaJSON(reader)
+        } else {
+                req, err = readVegetaBinary(reader)
+        }
+        if err != nil {
+                return nil, err
+        }
+
+        raw := map[string]interface{}{
+                "source":     "vegeta",
+                "input":      input,
+                "assertions": evaluateImportedNFRs(project, req),
+        }
+        req.RawResults, _ = json.Marshal(raw)
+
+        return req, nil
+}
+
+// readVegetaJSON tells a report from a stream of results by the first object
+func readVegetaJSON(r io.Reader) (string, *models.SendResultsRequest, error) {
+        decoder := json.NewDecoder(r)
+
+        var first json.RawMessage
+        if err := decoder.Decode(&first); err != nil {
+                return "", nil, fmt.Errorf("invalid Vegeta JSON: %w", err)
+        }
+
+        var probe map[string]json.RawMessage
+        json.Unmarshal(first, &probe)
+        if _, ok := probe["latencies"]; ok {
+                var report vegetaReport
+                if err := json.Unmarshal(first, &report); err != nil {
+                        return "", nil, fmt.Errorf("invalid Vegeta report: %w", err)
+                }
+                req, err := vegetaReportResults(report)
+                return "report", req, err
+        }
+
+        aggregator := newSampleAggregator()
+        var result vegetaResult
+        if err := json.Unmarshal(first, &result); err != nil {
+                return "", nil, fmt.Errorf("invalid Vegeta result: %w", err)
+        }
+        addVegetaResult(aggregator, result)
+        for {
+                var result vegetaResult
+                err := decoder.Decode(&result)
+                if err == io.EOF {
+                        break
+                }
+                if err != nil {
+                        return "", nil, fmt.Errorf("invalid Vegeta result: %w", err)
+                }
+                addVegetaResult(aggregator, result)
+        }
+
+        return "results", aggregator.Result(), nil
+}
+
+func readVegetaBinary(r io.Reader) (*models.SendResultsRequest, error) {
+        aggregator := newSampleAggregator()
+        decoder := gob.NewDecoder(r)
+        count := 0
+        for {
+                var result vegetaResult
+                err := decoder.Decode(&result)
+                if err == io.EOF {
+                        break
+                }
+                if err != nil {
+                        return nil, fmt.Errorf("invalid Vegeta binary results: %w", err)
+                }
+                addVegetaResult(aggregator, result)
+                count++
+        }
+        if count == 0 {
+                return nil, fmt.Errorf("Vegeta results are empty")
+        }
+        return aggregator.Result(), nil
+}
+
+// addVegetaResult records a result; like vegeta itself, codes 200-399 count as success
+func addVegetaResult(aggregator *sampleAggregator, result vegetaResult) {
+        name := result.URL
+        if parsed, err := url.Parse(result.URL); err == nil && parsed.Path != "" {
+                name = parsed.Path
+        }
+        if result.Method != "" {
+                name = result.Method + " " + name
+        }
+
+        ok := result.Code >= 200 && result.Code < 400
+        errorCode := strconv.Itoa(int(result.Code))
+        if result.Code == 0 && result.Error != "" {
+                errorCode = truncateErrorCode(result.Error)
+        }
+
+        aggregator.Add(name, result.Timestamp, result.Latency, ok, errorCode)
+}
+
+// vegetaReportResults maps the run-wide report onto a single endpoint
+func vegetaReportResults(report vegetaReport) (*models.SendResultsRequest, error) {
+        if report.Requests == 0 {
+                return nil, fmt.Errorf("Vegeta report has no requests")
+        }
+
+        successful := int(math.Round(float64(report.Requests) * report.Success))
+        req := &models.SendResultsRequest{
+                SuccessfulCalls: successful,
+                FailedCalls:     report.Requests - successful,
+        }
+        if report.Rate > 0 {
+                rate := report.Rate
+                req.AchievedRPS = &rate
+        }
+        if report.Duration > 0 {
+                req.TestDuration, _ = json.Marshal((report.Duration + report.Wait) / float64(time.Second))
+        }
+
+        ms := func(ns float64) *float64 {
+                value := ns / float64(time.Millisecond)
+                return &value
+        }
+        endpoint := models.EndpointMetrics{
+                Name:     "all requests",
+                P50:      ms(report.Latencies.P50),
+                P90:      ms(report.Latencies.P90),
+                P95:      ms(report.Latencies.P95),
+                P99:      ms(report.Latencies.P99),
+                Max:      ms(report.Latencies.Max),
+                RPS:      req.AchievedRPS,
+                Requests: report.Requests,
+                Errors:   req.FailedCalls,
+        }
+        for code, count := range report.StatusCodes {
+                if value, err := strconv.Atoi(code); err == nil && value >= 200 && value < 400 {
+                        continue
+                }
+                if endpoint.ErrorCounts == nil {
+                        endpoint.ErrorCounts = make(map[string]int)
+                }
+                endpoint.ErrorCounts[code] = count
+        }
+        req.Endpoints = []models.EndpointMetrics{endpoint}
+
+        return req, nil
+}
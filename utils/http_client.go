@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -25,26 +26,26 @@ func NewLoggedHTTPClient() *LoggedHTTPClient {
 }
 
 // Post makes a POST request with detailed logging
-func (c *LoggedHTTPClient) Post(url string, body interface{}) (*http.Response, error) {
-	return c.doRequest("POST", url, body)
+func (c *LoggedHTTPClient) Post(ctx context.Context, url string, body interface{}) (*http.Response, error) {
+	return c.doRequest(ctx, "POST", url, body)
 }
 
 // Get makes a GET request with detailed logging
-func (c *LoggedHTTPClient) Get(url string) (*http.Response, error) {
-	return c.doRequest("GET", url, nil)
+func (c *LoggedHTTPClient) Get(ctx context.Context, url string) (*http.Response, error) {
+	return c.doRequest(ctx, "GET", url, nil)
 }
 
 // Put makes a PUT request with detailed logging
-func (c *LoggedHTTPClient) Put(url string, body interface{}) (*http.Response, error) {
-	return c.doRequest("PUT", url, body)
+func (c *LoggedHTTPClient) Put(ctx context.Context, url string, body interface{}) (*http.Response, error) {
+	return c.doRequest(ctx, "PUT", url, body)
 }
 
 // Delete makes a DELETE request with detailed logging
-func (c *LoggedHTTPClient) Delete(url string) (*http.Response, error) {
-	return c.doRequest("DELETE", url, nil)
+func (c *LoggedHTTPClient) Delete(ctx context.Context, url string) (*http.Response, error) {
+	return c.doRequest(ctx, "DELETE", url, nil)
 }
 
-func (c *LoggedHTTPClient) doRequest(method, url string, body interface{}) (*http.Response, error) {
+func (c *LoggedHTTPClient) doRequest(ctx context.Context, method, url string, body interface{}) (*http.Response, error) {
 	start := time.Now()
 	
 	// Prepare request body
@@ -62,7 +63,7 @@ func (c *LoggedHTTPClient) doRequest(method, url string, body interface{}) (*htt
 	}
 	
 	// Create request
-	req, err := http.NewRequest(method, url, requestBody)
+	req, err := http.NewRequestWithContext(ctx, method, url, requestBody)
 	if err != nil {
 		log.Printf("Failed to create HTTP request: %v", err)
 		return nil, err